@@ -0,0 +1,86 @@
+// Command import-users creates users from a CSV or NDJSON file, like POST /users/import,
+// and prints the per-row report as JSON. It exits with status 1 when any row failed.
+//
+//	go run ./cmd/import-users -file users.csv -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+func main() {
+	file := flag.String("file", "", "CSV or NDJSON file to import, - for standard input")
+	format := flag.String("format", "", "csv or ndjson; guessed from the file extension when empty")
+	dryRun := flag.Bool("dry-run", false, "only validate the rows")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		opened, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer opened.Close()
+		input = opened
+	}
+
+	importFormat, err := helpers.ImportFormat(*format, "", *file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := helpers.ParseImport(input, importFormat)
+	if err != nil {
+		log.Fatal("The file could not be read: ", err)
+	}
+
+	// Connect to MongoDB and initialize what the import writes to
+	database.ConnectDB()
+	helpers.InitializeTokenHelper()
+	helpers.InitializeAuditHelper()
+	helpers.InitializeWebhookHelper()
+	helpers.InitializeOutboxHelper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	report, err := helpers.ImportUsers(ctx, rows, *dryRun)
+	if err != nil {
+		log.Fatal("Error occurred while importing users: ", err)
+	}
+
+	if !*dryRun {
+		helpers.AuditSystem(ctx, helpers.AuditRecord{Action: helpers.AuditUserImport, TargetType: "user", Reason: fmt.Sprintf("import-users %s: created %d of %d rows", filepath.Base(*file), report.Created, report.Total)})
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	cancel()
+	database.DisconnectDB()
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
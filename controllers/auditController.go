@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditCollection *mongo.Collection
+
+// InitializeAuditController initializes the package variables after DB connection
+func InitializeAuditController() {
+	auditCollection = database.GetCollection("audit_log")
+}
+
+// GetAuditEvents lists audit log entries, newest first, filtered by actor, target,
+// action, outcome and time range (Admin only)
+func GetAuditEvents() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if auditCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Build the filter from the query string
+		filter := bson.M{}
+		for param, field := range map[string]string{
+			"actor":   "actor_id",
+			"target":  "target_id",
+			"action":  "action",
+			"outcome": "outcome",
+		} {
+			if value := c.Query(param); value != "" {
+				filter[field] = value
+			}
+		}
+
+		createdAt := bson.M{}
+		for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+			raw := c.Query(param)
+			if raw == "" {
+				continue
+			}
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": param + " must be an RFC 3339 timestamp",
+				})
+				return
+			}
+			createdAt[operator] = value
+		}
+		if len(createdAt) > 0 {
+			filter["created_at"] = createdAt
+		}
+
+		// Set default pagination values
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 || recordPerPage > 100 {
+			recordPerPage = 50
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		total, err := auditCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing audit events",
+			})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "sequence", Value: -1}}).
+			SetSkip(int64((page - 1) * recordPerPage)).
+			SetLimit(int64(recordPerPage))
+		cursor, err := auditCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing audit events",
+			})
+			return
+		}
+
+		events := []models.AuditEvent{}
+		if err := cursor.All(ctx, &events); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing audit events",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": total,
+			"events":      events,
+			"page":        page,
+			"per_page":    recordPerPage,
+		})
+	})
+}
+
+// VerifyAuditLog recomputes the hash chain of the audit log and reports the first broken entry (Admin only)
+func VerifyAuditLog() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		checked, brokenAt, err := helpers.VerifyAuditChain(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while verifying the audit log",
+			})
+			return
+		}
+
+		outcome := helpers.AuditSuccess
+		if brokenAt > 0 {
+			outcome = helpers.AuditFailure
+		}
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogVerify, Outcome: outcome})
+
+		response := gin.H{
+			"valid":   brokenAt == 0,
+			"checked": checked,
+		}
+		if brokenAt > 0 {
+			response["broken_at"] = brokenAt
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
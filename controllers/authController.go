@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -49,6 +51,35 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	return check, msg
 }
 
+// requestMaxBytes bounds the JSON bodies of the account endpoints
+const requestMaxBytes = 64 << 10
+
+// signupRequest is the body accepted by Signup. New accounts are always USER accounts.
+type signupRequest struct {
+	First_name string `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name  string `json:"last_name" validate:"required,min=2,max=100"`
+	Password   string `json:"password" validate:"required,min=6"`
+	Email      string `json:"email" validate:"required,email"`
+	Phone      string `json:"phone" validate:"required"`
+}
+
+// loginRequest is the body accepted by Login
+type loginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Scope    string `json:"scope"`
+}
+
+// reauthenticateRequest is the body accepted by Reauthenticate
+type reauthenticateRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// refreshRequest is the body accepted by Refresh when the refresh token is not a cookie
+type refreshRequest struct {
+	Refresh_token string `json:"refresh_token" validate:"required"`
+}
+
 // Signup creates a new user account
 func Signup() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -62,29 +93,14 @@ func Signup() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		var user models.User
-
-		// Bind JSON request to user struct
-		if err := c.BindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "user fields are required " + err.Error(),
-			})
-			return
-		}
-
-		// Validate the user struct
-		validationErr := validate.Struct(user)
-		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": validationErr.Error(),
-			})
+		var request signupRequest
+		if !bindRequest(c, &request) {
 			return
 		}
 
 		// Check if user already exists by email
-		count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email})
+		emailCount, err := userCollection.CountDocuments(ctx, bson.M{"email": request.Email})
 		if err != nil {
-			log.Panic(err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Error occurred while checking for the email",
 			})
@@ -92,16 +108,16 @@ func Signup() gin.HandlerFunc {
 		}
 
 		// Check if user already exists by phone
-		count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
+		phoneCount, err := userCollection.CountDocuments(ctx, bson.M{"phone": request.Phone})
 		if err != nil {
-			log.Panic(err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Error occurred while checking for the phone number",
 			})
 			return
 		}
 
-		if count > 0 {
+		if emailCount > 0 || phoneCount > 0 {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditSignup, Outcome: helpers.AuditFailure, ActorEmail: request.Email, Reason: "email or phone number already exists"})
 			c.JSON(http.StatusConflict, gin.H{
 				"error": "This email or phone number already exists",
 			})
@@ -109,8 +125,20 @@ func Signup() gin.HandlerFunc {
 		}
 
 		// Hash the password
-		password := HashPassword(*user.Password)
-		user.Password = &password
+		password := HashPassword(request.Password)
+
+		// New accounts are active unless approval is required, in which case they start out pending
+		status := helpers.NewAccountStatus()
+		userType := "USER"
+		user := models.User{
+			First_name: &request.First_name,
+			Last_name:  &request.Last_name,
+			Password:   &password,
+			Email:      &request.Email,
+			Phone:      &request.Phone,
+			User_type:  &userType,
+			Status:     &status,
+		}
 
 		// Set user timestamps and ID
 		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -118,13 +146,23 @@ func Signup() gin.HandlerFunc {
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
 
-		// Generate JWT tokens
-		token, refreshToken, _ := helpers.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id)
-		user.Token = &token
-		user.Refresh_token = &refreshToken
+		// Generate JWT tokens, unless the account waits for approval
+		var token, refreshToken string
+		if status == helpers.StatusActive {
+			token, refreshToken, _ = helpers.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id)
+			user.Token = &token
+			user.Refresh_token = &refreshToken
+		} else {
+			user.Token, user.Refresh_token = nil, nil
+		}
 
-		// Insert user into database
-		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
+		// Insert user into database together with its created event
+		insertErr := database.WithTransaction(ctx, func(ctx context.Context) error {
+			if _, err := userCollection.InsertOne(ctx, user); err != nil {
+				return err
+			}
+			return helpers.WriteOutboxEvent(ctx, helpers.EventUserCreated, user.User_id, helpers.UserEventData(user))
+		})
 		if insertErr != nil {
 			msg := fmt.Sprintf("User item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -133,13 +171,22 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditSignup, ActorID: user.User_id, ActorEmail: *user.Email, TargetType: "user", TargetID: user.User_id})
+
+		if status != helpers.StatusActive {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "User created successfully and is pending activation",
+				"user_id": user.ID,
+				"status":  status,
+			})
+			return
+		}
+
 		// Return success response
-		c.JSON(http.StatusOK, gin.H{
-			"message":       "User created successfully",
-			"user_id":       resultInsertionNumber.InsertedID,
-			"token":         token,
-			"refresh_token": refreshToken,
-		})
+		respondWithTokens(c, gin.H{
+			"message": "User created successfully",
+			"user_id": user.ID,
+		}, token, refreshToken)
 	})
 }
 
@@ -156,20 +203,47 @@ func Login() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		var user models.User
+		var request loginRequest
 		var foundUser models.User
+		if !bindRequest(c, &request) {
+			return
+		}
 
-		// Bind JSON request to user struct
-		if err := c.BindJSON(&user); err != nil {
+		// Clients may ask for a narrower set of scopes than the default
+		scopes, err := helpers.NarrowScopes(request.Scope, helpers.AllScopes)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
 
+		// Bind the tokens to the client's key when it presents a DPoP proof
+		jkt, ok := dpopThumbprint(c)
+		if !ok {
+			return
+		}
+
+		attemptedEmail := request.Email
+
 		// Find user by email
-		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+		err = userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"email": request.Email})).Decode(&foundUser)
 		if err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, ActorEmail: attemptedEmail, Reason: "unknown email"})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Email or password is incorrect",
+			})
+			return
+		}
+
+		// Accounts provisioned through an identity provider, or imported without a
+		// password, have no local password until the user sets one
+		if foundUser.Password == nil {
+			reason := "account has no password"
+			if foundUser.Password_reset_required {
+				reason = "password reset required"
+			}
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, ActorID: foundUser.User_id, ActorEmail: attemptedEmail, Reason: reason})
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Email or password is incorrect",
 			})
@@ -177,8 +251,9 @@ func Login() gin.HandlerFunc {
 		}
 
 		// Verify password
-		passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
+		passwordIsValid, msg := VerifyPassword(request.Password, *foundUser.Password)
 		if !passwordIsValid {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, ActorID: foundUser.User_id, ActorEmail: attemptedEmail, Reason: "wrong password"})
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": msg,
 			})
@@ -193,14 +268,29 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		// Suspended, locked and pending accounts cannot sign in
+		if refuseInactiveAccount(c, foundUser, helpers.AuditLogin, "password") {
+			return
+		}
+
+		// Users with a registered passkey finish the login with it, always when passkeys are
+		// required as a second factor and on risky logins when LOGIN_RISK_MFA is set. Users
+		// without a passkey cannot be challenged and are only notified of risky logins.
+		loginEvent, ok := beginLogin(ctx, c, foundUser, "password", strings.Join(scopes, " "))
+		if !ok {
+			return
+		}
+
 		// Generate new JWT tokens
-		token, refreshToken, _ := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id)
+		token, refreshToken, _ := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id, helpers.WithScopes(scopes), helpers.WithAuthTime(time.Now()), helpers.WithConfirmation(jkt))
 
 		// Update tokens in database
 		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+		recordLogin(ctx, c, foundUser, loginEvent)
 
 		// Find updated user
-		err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+		var signedIn models.User
+		err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}, options.FindOne().SetProjection(helpers.UserProfileProjection)).Decode(&signedIn)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -209,15 +299,365 @@ func Login() gin.HandlerFunc {
 		}
 
 		// Return success response
+		respondWithTokens(c, signedInBody(signedIn, gin.H{
+			"message":    "Login successful",
+			"scope":      strings.Join(scopes, " "),
+			"token_type": tokenType(jkt),
+		}), token, refreshToken)
+	})
+}
+
+// Reauthenticate verifies the user's password again and returns an access token with a fresh
+// auth_time for the current session, keeping its scopes, expiry and refresh token
+func Reauthenticate() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Only the user themselves can prove their identity again
+		if err := helpers.CheckNotImpersonated(c); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if c.GetString("auth_method") != "jwt" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Only login sessions can be re-authenticated",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request reauthenticateRequest
+		if !bindRequest(c, &request) {
+			return
+		}
+
+		// Find the current user
+		var foundUser models.User
+		err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": c.GetString("uid")})).Decode(&foundUser)
+		if err != nil || foundUser.Password == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Password is incorrect",
+			})
+			return
+		}
+
+		// Verify password
+		if passwordIsValid, _ := VerifyPassword(request.Password, *foundUser.Password); !passwordIsValid {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditReauthenticate, Outcome: helpers.AuditFailure, Reason: "wrong password"})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Password is incorrect",
+			})
+			return
+		}
+
+		// Keep the lifetime of the current access token, which is never longer than a fresh one
+		ttl := min(time.Until(c.GetTime("expires_at")), helpers.AccessTokenTTL)
+		if ttl <= 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Token is expired",
+			})
+			return
+		}
+
+		token, err := helpers.GenerateAccessToken(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id, ttl,
+			helpers.WithScopes(c.GetStringSlice("scopes")),
+			helpers.WithAuthTime(time.Now()),
+			helpers.WithConfirmation(c.GetString("dpop_jkt")),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating the token",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditReauthenticate})
+
+		respondWithTokens(c, gin.H{
+			"message": "Re-authentication successful",
+		}, token, "")
+	})
+}
+
+// Refresh exchanges a valid refresh token for a new token pair, keeping its scopes,
+// auth_time and DPoP binding. The presented refresh token is rotated out.
+func Refresh() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request refreshRequest
+
+		// Browsers in cookie session mode send the refresh token as a cookie
+		cookie, _ := c.Cookie(helpers.RefreshTokenCookie)
+		if helpers.CookieSessions && cookie != "" {
+			if !helpers.CheckCSRFToken(c) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "Missing or invalid CSRF token",
+				})
+				return
+			}
+			request.Refresh_token = cookie
+		} else {
+			if !bindRequest(c, &request) {
+				return
+			}
+		}
+
+		// Validate the refresh token
+		claims, msg := helpers.ValidateToken(request.Refresh_token)
+		if msg == "" && claims.Typ == helpers.TokenTypeAccess {
+			msg = "an access token was given"
+		}
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid refresh token: " + msg,
+			})
+			return
+		}
+
+		// Only the most recently issued refresh token of the user is accepted
+		var foundUser models.User
+		err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": claims.Uid})).Decode(&foundUser)
+		if err != nil || foundUser.Refresh_token == nil || *foundUser.Refresh_token != request.Refresh_token {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditRefresh, Outcome: helpers.AuditFailure, ActorID: claims.Uid, ActorEmail: claims.Email, Reason: "refresh token is not the current one"})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid refresh token",
+			})
+			return
+		}
+
+		// Sessions end when the account stops being active, for instance once a suspension starts
+		if refuseInactiveAccount(c, foundUser, helpers.AuditRefresh, "refresh") {
+			return
+		}
+
+		// A bound refresh token can only be used with a proof from the same key
+		jkt, ok := dpopThumbprint(c)
+		if !ok {
+			return
+		}
+		if claims.Cnf != nil && claims.Cnf.Jkt != jkt {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_dpop_proof",
+				"error_description": "The refresh token is bound to a different DPoP key",
+			})
+			return
+		}
+
+		opts := []helpers.TokenOption{
+			helpers.WithScopes(claims.Scopes()),
+			helpers.WithConfirmation(jkt),
+		}
+		if claims.Auth_time != nil {
+			opts = append(opts, helpers.WithAuthTime(claims.Auth_time.Time))
+		}
+
+		// Generate new JWT tokens from the current user record
+		token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id, opts...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating tokens",
+			})
+			return
+		}
+
+		// Update tokens in database
+		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditRefresh, ActorID: foundUser.User_id, ActorEmail: *foundUser.Email})
+
+		respondWithTokens(c, gin.H{
+			"message":    "Token refreshed successfully",
+			"scope":      strings.Join(claims.Scopes(), " "),
+			"token_type": tokenType(jkt),
+		}, token, refreshToken)
+	})
+}
+
+// Logout ends the current session by forgetting the stored tokens and clearing session cookies
+func Logout() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Without a stored refresh token the session cannot be refreshed any more.
+		// An impersonation session must not end the impersonated user's own session.
+		if !c.GetBool("impersonated") {
+			userId := c.GetString("uid")
+			err := database.WithTransaction(ctx, func(ctx context.Context) error {
+				_, err := userCollection.UpdateOne(ctx,
+					bson.M{"user_id": userId},
+					bson.M{"$set": bson.M{"token": nil, "refresh_token": nil}},
+				)
+				if err != nil {
+					return err
+				}
+				return helpers.WriteOutboxEvent(ctx, helpers.EventSessionRevoked, userId, gin.H{"user_id": userId, "reason": "logout"})
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Error occurred while logging out",
+				})
+				return
+			}
+		}
+
+		helpers.ClearSessionCookies(c)
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogout})
+
 		c.JSON(http.StatusOK, gin.H{
-			"message":       "Login successful",
-			"user_id":       foundUser.User_id,
-			"email":         foundUser.Email,
-			"first_name":    foundUser.First_name,
-			"last_name":     foundUser.Last_name,
-			"user_type":     foundUser.User_type,
-			"token":         token,
-			"refresh_token": refreshToken,
+			"message": "Logout successful",
 		})
 	})
 }
+
+// bindRequest decodes and validates a JSON request body. It answers 400 and returns
+// false when the body is not acceptable.
+func bindRequest(c *gin.Context, request interface{}) bool {
+	if err := helpers.DecodeJSONBody(c, request, requestMaxBytes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	if err := validate.Struct(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": strings.Join(helpers.ValidationErrorMessages(err), "; "),
+		})
+		return false
+	}
+	return true
+}
+
+// signedInBody adds the profile of a user who just signed in to a token response
+func signedInBody(user models.User, body gin.H) gin.H {
+	profile := helpers.NewUserProfile(user)
+	body["user_id"] = profile.User_id
+	body["email"] = profile.Email
+	body["first_name"] = profile.First_name
+	body["last_name"] = profile.Last_name
+	body["user_type"] = profile.User_type
+	return body
+}
+
+// respondWithTokens sends a successful token response. In cookie session mode the
+// tokens are set as HttpOnly cookies and left out of the body.
+func respondWithTokens(c *gin.Context, body gin.H, token string, refreshToken string) {
+	if !helpers.CookieSessions {
+		body["token"] = token
+		if refreshToken != "" {
+			body["refresh_token"] = refreshToken
+		}
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	if err := helpers.SetSessionCookies(c, token, refreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error occurred while creating the session",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// dpopThumbprint validates the DPoP proof of a token request, if any, and returns
+// its key thumbprint. It writes the error response and returns false on failure.
+func dpopThumbprint(c *gin.Context) (string, bool) {
+	proof := c.GetHeader("DPoP")
+	if proof == "" {
+		return "", true
+	}
+
+	jkt, err := helpers.ValidateDPoPProof(proof, c.Request.Method, helpers.RequestURL(c.Request), "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_dpop_proof",
+			"error_description": err.Error(),
+		})
+		return "", false
+	}
+	return jkt, true
+}
+
+// beginLogin compares a login by method with the user's earlier logins and, for users with a
+// registered passkey, starts the second factor when it is required or the login looks risky.
+// It returns false when the response has been written and no tokens may be issued yet.
+func beginLogin(ctx context.Context, c *gin.Context, user models.User, method string, scope string) (*models.LoginEvent, bool) {
+	event := helpers.AssessLogin(ctx, user.User_id, method, c.ClientIP(), c.Request.UserAgent())
+	if requireSecondFactor(ctx, c, user, method, scope, helpers.LoginRiskMFA && event.Risky) {
+		return nil, false
+	}
+	return event, true
+}
+
+// recordLogin stores where a successful login came from in the login history and the audit log,
+// and notifies the user when it looks unusual
+func recordLogin(ctx context.Context, c *gin.Context, user models.User, event *models.LoginEvent) {
+	helpers.RecordLoginEvent(ctx, user, event)
+
+	var email string
+	if user.Email != nil {
+		email = *user.Email
+	}
+	helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, ActorID: user.User_id, ActorEmail: email, Reason: event.Method})
+}
+
+// refuseInactiveAccount tells the owner of an account that is not active why they cannot
+// sign in, and reports whether the request was refused. Call it only once the user has
+// proven who they are, so the status of an account is not revealed to others.
+func refuseInactiveAccount(c *gin.Context, user models.User, action string, method string) bool {
+	status := helpers.UserAccountStatus(user)
+	if status == helpers.StatusActive {
+		return false
+	}
+
+	var email string
+	if user.Email != nil {
+		email = *user.Email
+	}
+	helpers.Audit(c, helpers.AuditRecord{Action: action, Outcome: helpers.AuditDenied, ActorID: user.User_id, ActorEmail: email, Reason: method + ": account " + status})
+
+	body := gin.H{
+		"error":  helpers.AccountStatusMessage(status),
+		"status": status,
+	}
+	if user.Status_until != nil {
+		body["until"] = user.Status_until
+	}
+	c.JSON(http.StatusForbidden, body)
+	return true
+}
+
+// tokenType returns the token_type reported to clients
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
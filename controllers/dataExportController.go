@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportUserData hands a user everything stored about them as a JSON document or a ZIP
+// archive (?format=zip). Large accounts, or requests with ?async=true, get a background
+// export instead, whose status is polled until it can be downloaded.
+func ExportUserData() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", helpers.DataExportJSON)
+		if !helpers.ValidDataExportFormat(format) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "format must be json or zip",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		count, err := helpers.CountUserRecords(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while preparing the export",
+			})
+			return
+		}
+
+		if c.Query("async") == "true" || count > helpers.DataExportSyncLimit {
+			export, err := helpers.CreateDataExport(ctx, userId, c.GetString("uid"), format)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Error occurred while creating the export",
+				})
+				return
+			}
+
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserExport, TargetType: "user", TargetID: userId, Reason: "queued " + export.Export_id})
+
+			c.Header("Location", dataExportURL(export))
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "The export is being prepared",
+				"export":  export,
+			})
+			return
+		}
+
+		bundle, err := helpers.CollectUserData(ctx, userId)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while collecting the export",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserExport, TargetType: "user", TargetID: userId})
+
+		c.Header("Content-Type", helpers.DataExportContentType(format))
+		c.Header("Content-Disposition", `attachment; filename="`+helpers.DataExportFilename(userId, format)+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		helpers.WriteUserDataBundle(c.Writer, bundle, format)
+	})
+}
+
+// GetDataExport reports the status of a background export
+func GetDataExport() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		export, err := helpers.FindDataExport(ctx, userId, c.Param("export_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Export not found",
+			})
+			return
+		}
+
+		response := gin.H{
+			"export": export,
+		}
+		if export.Status == helpers.DataExportReady {
+			response["download_url"] = dataExportURL(export) + "/download"
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+// DownloadDataExport downloads the bundle of a finished background export
+func DownloadDataExport() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		export, err := helpers.FindDataExport(ctx, userId, c.Param("export_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Export not found",
+			})
+			return
+		}
+		if export.Status != helpers.DataExportReady {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "The export is not ready",
+				"status": export.Status,
+			})
+			return
+		}
+
+		stream, err := helpers.OpenDataExport(export)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while opening the export",
+			})
+			return
+		}
+		defer stream.Close()
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserExport, TargetType: "user", TargetID: userId, Reason: "downloaded " + export.Export_id})
+
+		c.Header("Content-Type", helpers.DataExportContentType(export.Format))
+		c.Header("Content-Disposition", `attachment; filename="`+helpers.DataExportFilename(userId, export.Format)+`"`)
+		c.Header("Content-Length", strconv.FormatInt(export.Size, 10))
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		io.Copy(c.Writer, stream)
+	})
+}
+
+// dataExportURL returns the path of an export's status endpoint
+func dataExportURL(export *models.DataExport) string {
+	return "/users/" + export.User_id + "/exports/" + export.Export_id
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var impersonationCollection *mongo.Collection
+var impersonationTTL = 15 * time.Minute
+
+// impersonateRequest is the body accepted by Impersonate
+type impersonateRequest struct {
+	Reason string `json:"reason" validate:"required,min=5,max=500"`
+}
+
+// InitializeImpersonationController initializes the package variables after DB connection
+func InitializeImpersonationController() {
+	impersonationCollection = database.GetCollection("impersonation_sessions")
+
+	if raw := os.Getenv("IMPERSONATION_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			log.Fatal("IMPERSONATION_TTL must be a positive duration such as 15m")
+		}
+		impersonationTTL = ttl
+	}
+}
+
+// Impersonate issues a short-lived access token for the target user carrying the admin as actor (Admin only)
+func Impersonate() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if impersonationCollection == nil || userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if userId == c.GetString("uid") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "You cannot impersonate yourself",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request impersonateRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+
+		// Find the target user
+		var target models.User
+		err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": userId})).Decode(&target)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+
+		// A token cannot be issued without them
+		if target.Email == nil || target.User_type == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "User account is incomplete and cannot be impersonated",
+			})
+			return
+		}
+
+		if *target.User_type == "ADMIN" {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditImpersonate, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: target.User_id, Reason: "target is an admin"})
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admin accounts cannot be impersonated",
+			})
+			return
+		}
+
+		// The tokens would be refused anyway
+		if status := helpers.UserAccountStatus(target); status != helpers.StatusActive {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Only active accounts can be impersonated",
+				"status": status,
+			})
+			return
+		}
+
+		// Record the session before any token exists
+		now := time.Now().UTC()
+		session := models.ImpersonationSession{
+			ID:          primitive.NewObjectID(),
+			Admin_id:    c.GetString("uid"),
+			Admin_email: c.GetString("email"),
+			Target_id:   target.User_id,
+			Reason:      request.Reason,
+			Ip_address:  c.ClientIP(),
+			User_agent:  c.Request.UserAgent(),
+			Created_at:  now,
+			Expires_at:  now.Add(impersonationTTL),
+		}
+		session.Session_id = session.ID.Hex()
+
+		if _, err := impersonationCollection.InsertOne(ctx, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Impersonation session was not created",
+			})
+			return
+		}
+
+		// The impersonation token never carries more than the admin's own scopes
+		scopes := slices.DeleteFunc(slices.Clone(c.GetStringSlice("scopes")), func(scope string) bool {
+			return scope == helpers.ScopeUsersImpersonate
+		})
+
+		var firstName, lastName string
+		if target.First_name != nil {
+			firstName = *target.First_name
+		}
+		if target.Last_name != nil {
+			lastName = *target.Last_name
+		}
+
+		token, err := helpers.GenerateAccessToken(*target.Email, firstName, lastName, *target.User_type, target.User_id, impersonationTTL,
+			helpers.WithScopes(scopes),
+			helpers.WithActor(session.Admin_id, session.Admin_email, session.Session_id),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating the token",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditImpersonate, TargetType: "user", TargetID: target.User_id, Reason: request.Reason})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "Impersonation session started",
+			"session_id": session.Session_id,
+			"user_id":    target.User_id,
+			"token":      token,
+			"expires_at": session.Expires_at,
+		})
+	})
+}
+
+// GetImpersonationSessions lists the impersonation sessions targeting a user (Admin only)
+func GetImpersonationSessions() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if impersonationCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := impersonationCollection.Find(ctx, bson.M{"target_id": userId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing impersonation sessions",
+			})
+			return
+		}
+
+		sessions := []models.ImpersonationSession{}
+		if err := cursor.All(ctx, &sessions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing impersonation sessions",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sessions": sessions,
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestImpersonateRefusesIncompleteAccount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("target without an email", func(mt *mtest.T) {
+		userCollection, impersonationCollection = mt.Coll, mt.Coll
+		mt.Cleanup(func() { userCollection, impersonationCollection = nil, nil })
+
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.POST("/users/:user_id/impersonate", func(c *gin.Context) {
+			c.Set("uid", "admin-1")
+			c.Set("user_type", "ADMIN")
+		}, Impersonate())
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+			{Key: "user_id", Value: "user-1"},
+			{Key: "user_type", Value: "USER"},
+		}))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/users/user-1/impersonate", strings.NewReader(`{"reason":"support ticket 42"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			mt.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "find" {
+				mt.Fatalf("impersonation ran %s, want only the lookup", event.CommandName)
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// Largest import file accepted
+const importMaxBytes = 10 << 20
+
+// ImportUsers creates users from a CSV or NDJSON file and reports the outcome per row
+// (Admin only). The file is sent as the request body or as the "file" field of a
+// multipart form; ?format= overrides the format guessed from its type or name. With
+// ?dry_run=true the rows are only validated.
+func ImportUsers() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBytes)
+
+		// Read the file from the form or the body
+		var body io.Reader = c.Request.Body
+		contentType, filename := c.ContentType(), ""
+		if contentType == "multipart/form-data" {
+			file, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "file is required",
+				})
+				return
+			}
+			opened, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			defer opened.Close()
+			body, contentType, filename = opened, file.Header.Get("Content-Type"), file.Filename
+		}
+
+		format, err := helpers.ImportFormat(c.Query("format"), contentType, filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		rows, err := helpers.ParseImport(body, format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The file could not be read: " + err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		dryRun := c.Query("dry_run") == "true"
+		report, err := helpers.ImportUsers(ctx, rows, dryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while importing users",
+			})
+			return
+		}
+
+		if !dryRun {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserImport, TargetType: "user", Reason: fmt.Sprintf("created %d of %d rows", report.Created, report.Total)})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"report": report,
+		})
+	})
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const magicLinkNonceCookie = "magic_link_nonce"
+
+var magicLinkCollection *mongo.Collection
+var magicLinkEnabled bool
+var magicLinkTTL = 15 * time.Minute
+var magicLinkURL string
+var magicLinkRateLimit int64 = 5
+var magicLinkRateWindow = time.Hour
+
+// emailCollation compares emails ignoring case. Emails are stored as typed, while a
+// mailbox usually accepts its address in any case.
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// magicLinkPayload is signed into the link sent by email
+type magicLinkPayload struct {
+	LinkID    string `json:"link_id"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// InitializeMagicLinkController initializes the package variables after DB connection.
+// MAGIC_LINK_ENABLED=true turns the feature on; MAGIC_LINK_URL is the callback URL put
+// in emails; MAGIC_LINK_TTL, MAGIC_LINK_RATE_LIMIT and MAGIC_LINK_RATE_WINDOW tune expiry
+// and how many links one address may request per window. The links are mailed, so
+// SMTP_HOST must be set as well.
+func InitializeMagicLinkController() {
+	magicLinkCollection = database.GetCollection("magic_links")
+	magicLinkEnabled = os.Getenv("MAGIC_LINK_ENABLED") == "true"
+	if !magicLinkEnabled {
+		return
+	}
+
+	// The log mailer would write working sign-in links to the log
+	if _, logOnly := helpers.DefaultMailer.(helpers.LogMailer); logOnly {
+		log.Fatal("MAGIC_LINK_ENABLED requires SMTP_HOST to be set")
+	}
+
+	magicLinkURL = os.Getenv("MAGIC_LINK_URL")
+	if magicLinkURL == "" {
+		log.Fatal("MAGIC_LINK_URL environment variable not set")
+	}
+
+	// Login links are requested by email in any case
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := database.GetCollection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_case_insensitive").SetCollation(emailCollation),
+	})
+	if err != nil {
+		log.Println("Failed to create case-insensitive email index:", err)
+	}
+
+	if raw := os.Getenv("MAGIC_LINK_TTL"); raw != "" {
+		if magicLinkTTL, err = time.ParseDuration(raw); err != nil || magicLinkTTL <= 0 {
+			log.Fatal("MAGIC_LINK_TTL must be a positive duration such as 15m")
+		}
+	}
+	if raw := os.Getenv("MAGIC_LINK_RATE_LIMIT"); raw != "" {
+		if magicLinkRateLimit, err = strconv.ParseInt(raw, 10, 64); err != nil || magicLinkRateLimit < 1 {
+			log.Fatal("MAGIC_LINK_RATE_LIMIT must be a positive number")
+		}
+	}
+	if raw := os.Getenv("MAGIC_LINK_RATE_WINDOW"); raw != "" {
+		if magicLinkRateWindow, err = time.ParseDuration(raw); err != nil || magicLinkRateWindow <= 0 {
+			log.Fatal("MAGIC_LINK_RATE_WINDOW must be a positive duration such as 1h")
+		}
+	}
+}
+
+// magicLinkRequest is the body accepted by RequestMagicLink
+type magicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// RequestMagicLink emails a single-use login link bound to the requesting browser
+func RequestMagicLink() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if !magicLinkEnabled {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Magic link login is not enabled",
+			})
+			return
+		}
+		// Ensure initialization
+		if magicLinkCollection == nil || userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request magicLinkRequest
+		if !bindRequest(c, &request) {
+			return
+		}
+		email := strings.ToLower(request.Email)
+
+		// Rate limit per address
+		count, err := magicLinkCollection.CountDocuments(ctx, bson.M{
+			"email":      email,
+			"created_at": bson.M{"$gte": time.Now().Add(-magicLinkRateWindow)},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while creating the login link",
+			})
+			return
+		}
+		if count >= magicLinkRateLimit {
+			c.Header("Retry-After", strconv.Itoa(int(magicLinkRateWindow.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many login links requested for this address, try again later",
+			})
+			return
+		}
+
+		// The nonce cookie ties the link to this browser
+		nonce, err := helpers.RandomString(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while creating the login link",
+			})
+			return
+		}
+
+		now := time.Now().UTC()
+		link := models.MagicLink{
+			ID:         primitive.NewObjectID(),
+			Email:      email,
+			Nonce_hash: helpers.HashSecret(nonce),
+			Ip_address: c.ClientIP(),
+			Created_at: now,
+			Expires_at: now.Add(magicLinkTTL),
+		}
+		link.Link_id = link.ID.Hex()
+
+		foundUser, err := findMagicLinkUser(ctx, request.Email)
+		if err == nil {
+			link.User_id = foundUser.User_id
+		}
+
+		if _, err := magicLinkCollection.InsertOne(ctx, link); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while creating the login link",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditMagicLinkRequest, ActorID: link.User_id, ActorEmail: email, TargetType: "magic_link", TargetID: link.Link_id})
+
+		// Only known addresses receive mail; the response is the same either way
+		if link.User_id != "" {
+			payload, _ := json.Marshal(magicLinkPayload{LinkID: link.Link_id, ExpiresAt: link.Expires_at.Unix()})
+			loginURL := magicLinkURL + "?token=" + url.QueryEscape(helpers.SignValue("magic-link", payload))
+
+			body := "Use the link below to sign in. It expires in " + magicLinkTTL.String() +
+				" and only works in the browser where you requested it.\n\n" + loginURL + "\n"
+			if err := helpers.SendMail(*foundUser.Email, "Your sign-in link", body); err != nil {
+				log.Println("Failed to send magic link:", err)
+			}
+		}
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(magicLinkNonceCookie, nonce, int(magicLinkTTL.Seconds()), "/auth/magic-link", "", c.Request.TLS != nil, true)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "If an account exists for this address, a login link has been sent",
+		})
+	})
+}
+
+// findMagicLinkUser returns the account an email address belongs to, ignoring case. When
+// several accounts differ only in the case of their email, only the exact address counts.
+func findMagicLinkUser(ctx context.Context, email string) (models.User, error) {
+	cursor, err := userCollection.Find(ctx, helpers.NotDeleted(bson.M{"email": email}), options.Find().SetCollation(emailCollation).SetLimit(10))
+	if err != nil {
+		return models.User{}, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return models.User{}, err
+	}
+
+	if len(users) == 1 && users[0].Email != nil {
+		return users[0], nil
+	}
+	for _, user := range users {
+		if user.Email != nil && *user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+// MagicLinkCallback consumes a login link and issues tokens
+func MagicLinkCallback() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if !magicLinkEnabled {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Magic link login is not enabled",
+			})
+			return
+		}
+		// Ensure initialization
+		if magicLinkCollection == nil || userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Check the signature and expiry of the link
+		var payload magicLinkPayload
+		raw, ok := helpers.VerifySignedValue("magic-link", c.Query("token"))
+		if !ok || json.Unmarshal(raw, &payload) != nil || time.Now().Unix() > payload.ExpiresAt {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "The login link is invalid or has expired",
+			})
+			return
+		}
+
+		// The link only works in the browser that requested it
+		nonce, err := c.Cookie(magicLinkNonceCookie)
+		if err != nil || nonce == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Open the login link in the browser where you requested it",
+			})
+			return
+		}
+
+		// Consume the link atomically so it cannot be used twice
+		var link models.MagicLink
+		err = magicLinkCollection.FindOneAndUpdate(ctx,
+			bson.M{
+				"link_id":    payload.LinkID,
+				"nonce_hash": helpers.HashSecret(nonce),
+				"used_at":    nil,
+				"expires_at": bson.M{"$gt": time.Now()},
+			},
+			bson.M{"$set": bson.M{"used_at": time.Now().UTC()}},
+		).Decode(&link)
+		if err != nil || link.User_id == "" {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, TargetType: "magic_link", TargetID: payload.LinkID, Reason: "magic link invalid, expired or used"})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "The login link is invalid, has expired or was already used",
+			})
+			return
+		}
+		c.SetCookie(magicLinkNonceCookie, "", -1, "/auth/magic-link", "", c.Request.TLS != nil, true)
+
+		var foundUser models.User
+		err = userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": link.User_id})).Decode(&foundUser)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+
+		if refuseInactiveAccount(c, foundUser, helpers.AuditLogin, "magic_link") {
+			return
+		}
+
+		// The link stands in for the password, so passkeys and risky logins are checked alike
+		loginEvent, ok := beginLogin(ctx, c, foundUser, "magic_link", strings.Join(helpers.AllScopes, " "))
+		if !ok {
+			return
+		}
+
+		// Generate new JWT tokens
+		token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id,
+			helpers.WithAuthTime(time.Now()),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating tokens",
+			})
+			return
+		}
+
+		// Update tokens in database
+		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+		recordLogin(ctx, c, foundUser, loginEvent)
+
+		respondWithTokens(c, signedInBody(foundUser, gin.H{
+			"message":    "Login successful",
+			"scope":      strings.Join(helpers.AllScopes, " "),
+			"token_type": tokenType(""),
+		}), token, refreshToken)
+	})
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFindMagicLinkUserIgnoresCase(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name    string
+		email   string
+		stored  []string
+		want    string
+		wantErr error
+	}{
+		{name: "stored in another case", email: "jane.doe@example.com", stored: []string{"Jane.Doe@Example.com"}, want: "Jane.Doe@Example.com"},
+		{name: "accounts differing in case", email: "Jane.Doe@example.com", stored: []string{"jane.doe@example.com", "Jane.Doe@example.com"}, want: "Jane.Doe@example.com"},
+		{name: "ambiguous", email: "JANE.DOE@example.com", stored: []string{"jane.doe@example.com", "Jane.Doe@example.com"}, wantErr: mongo.ErrNoDocuments},
+		{name: "unknown", email: "nobody@example.com", wantErr: mongo.ErrNoDocuments},
+	}
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			userCollection = mt.Coll
+			mt.Cleanup(func() { userCollection = nil })
+
+			namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+			var users []bson.D
+			for _, email := range test.stored {
+				users = append(users, bson.D{{Key: "user_id", Value: email}, {Key: "email", Value: email}})
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, users...))
+
+			user, err := findMagicLinkUser(context.Background(), test.email)
+			if err != test.wantErr || (err == nil && user.User_id != test.want) {
+				mt.Fatalf("findMagicLinkUser(%q) = %q, %v, want %q, %v", test.email, user.User_id, err, test.want, test.wantErr)
+			}
+
+			collation := mt.GetStartedEvent().Command.Lookup("collation").Document()
+			if collation.Lookup("strength").Int32() != 2 {
+				mt.Fatalf("lookup collation = %v, want a case-insensitive one", collation)
+			}
+		})
+	}
+}
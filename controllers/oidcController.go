@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const oidcFlowCookie = "oidc_flow"
+const oidcFlowTTL = 10 * time.Minute
+
+var errOIDCUnverifiedEmail = errors.New("identity provider did not supply a verified email address")
+var errOIDCAccountDeleted = errors.New("the account for this identity has been deleted")
+var errOIDCAccountExists = errors.New("an account with this email address already exists, sign in to it and link the identity provider from there")
+var errOIDCIdentityTaken = errors.New("this identity is already linked to another account")
+var errOIDCLinkUserNotFound = errors.New("user not found")
+
+// oidcFlowState is kept in a signed cookie between the redirect and the callback. A flow
+// started by OIDCLink carries the signed in user the identity is linked to.
+type oidcFlowState struct {
+	Provider  string `json:"provider"`
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	Scope     string `json:"scope"`
+	LinkUser  string `json:"link_user,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// OIDCProviders lists the configured upstream identity providers
+func OIDCProviders() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"providers": helpers.OIDCProviderNames(),
+		})
+	})
+}
+
+// OIDCLogin redirects the browser to the upstream provider's authorization endpoint
+func OIDCLogin() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Clients may ask for a narrower set of scopes than the default
+		scopes, err := helpers.NarrowScopes(c.Query("scope"), helpers.AllScopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		authURL, ok := startOIDCFlow(ctx, c, strings.Join(scopes, " "), "")
+		if !ok {
+			return
+		}
+		c.Redirect(http.StatusFound, authURL)
+	})
+}
+
+// OIDCLink starts linking an upstream identity to the signed in user's account. It returns
+// the authorization URL to open in the browser; the callback then links instead of signing in.
+func OIDCLink() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		authURL, ok := startOIDCFlow(ctx, c, "", c.GetString("uid"))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"authorization_url": authURL,
+		})
+	})
+}
+
+// startOIDCFlow keeps the state, nonce and PKCE verifier of a new code flow in the flow
+// cookie and returns the provider's authorization URL, or writes an error and returns false
+func startOIDCFlow(ctx context.Context, c *gin.Context, scope string, linkUser string) (string, bool) {
+	provider, err := helpers.GetOIDCProvider(ctx, c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return "", false
+	}
+
+	// Generate state, nonce and PKCE verifier for this attempt
+	flow := oidcFlowState{
+		Provider:  provider.Config.Name,
+		Scope:     scope,
+		LinkUser:  linkUser,
+		ExpiresAt: time.Now().Add(oidcFlowTTL).Unix(),
+	}
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *value, err = helpers.RandomString(32); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while starting the login",
+			})
+			return "", false
+		}
+	}
+
+	payload, _ := json.Marshal(flow)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, helpers.SignValue("oidc-flow", payload), int(oidcFlowTTL.Seconds()), "/auth/oidc", "", c.Request.TLS != nil, true)
+
+	return provider.AuthCodeURL(flow.State, flow.Nonce, flow.Verifier), true
+}
+
+// OIDCCallback validates the upstream response and either links the identity to the user
+// who started OIDCLink, or signs in or provisions the user it belongs to and issues our tokens
+func OIDCCallback() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if upstreamErr := c.Query("error"); upstreamErr != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Identity provider returned an error: " + upstreamErr,
+			})
+			return
+		}
+
+		// Restore and check the flow state set by OIDCLogin
+		var flow oidcFlowState
+		cookie, err := c.Cookie(oidcFlowCookie)
+		payload, ok := helpers.VerifySignedValue("oidc-flow", cookie)
+		if err != nil || !ok || json.Unmarshal(payload, &flow) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Login session is missing or invalid",
+			})
+			return
+		}
+		c.SetCookie(oidcFlowCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+
+		if flow.Provider != c.Param("provider") || flow.State != c.Query("state") || time.Now().Unix() > flow.ExpiresAt {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Login session is missing or invalid",
+			})
+			return
+		}
+
+		provider, err := helpers.GetOIDCProvider(ctx, flow.Provider)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Redeem the code and validate the upstream id_token
+		identity, err := provider.ExchangeOIDCCode(ctx, c.Query("code"), flow.Verifier, flow.Nonce)
+		if err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, Reason: "oidc:" + flow.Provider + ": " + err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if flow.LinkUser != "" {
+			err := linkIdentity(ctx, flow.LinkUser, flow.Provider, identity)
+			if err == errOIDCIdentityTaken || err == errOIDCLinkUserNotFound {
+				status := http.StatusConflict
+				if err == errOIDCLinkUserNotFound {
+					status = http.StatusNotFound
+				}
+				helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditIdentityLink, Outcome: helpers.AuditDenied, ActorID: flow.LinkUser, TargetType: "user", TargetID: flow.LinkUser, Reason: "oidc:" + flow.Provider + ": " + err.Error()})
+				c.JSON(status, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Error occurred while linking the account",
+				})
+				return
+			}
+
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditIdentityLink, ActorID: flow.LinkUser, TargetType: "user", TargetID: flow.LinkUser, Reason: "oidc:" + flow.Provider})
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Identity linked",
+				"provider": flow.Provider,
+			})
+			return
+		}
+
+		foundUser, err := findOrProvisionUser(ctx, flow.Provider, identity)
+		if err == errOIDCUnverifiedEmail || err == errOIDCAccountDeleted || err == errOIDCAccountExists {
+			status := http.StatusForbidden
+			if err == errOIDCAccountExists {
+				status = http.StatusConflict
+			}
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditDenied, ActorEmail: identity.Email, Reason: "oidc:" + flow.Provider + ": " + err.Error()})
+			c.JSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while signing in with the identity provider",
+			})
+			return
+		}
+
+		if refuseInactiveAccount(c, *foundUser, helpers.AuditLogin, "oidc:"+flow.Provider) {
+			return
+		}
+
+		// The provider stands in for the password, so passkeys and risky logins are checked alike
+		loginEvent, ok := beginLogin(ctx, c, *foundUser, "oidc:"+flow.Provider, flow.Scope)
+		if !ok {
+			return
+		}
+
+		// Issue our own tokens for the linked user, dated from when they authenticated at the
+		// provider, which may be earlier than now
+		authTime := time.Now()
+		if identity.AuthTime > 0 {
+			authTime = time.Unix(identity.AuthTime, 0)
+		}
+
+		token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id,
+			helpers.WithScopes(strings.Fields(flow.Scope)),
+			helpers.WithAuthTime(authTime),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating tokens",
+			})
+			return
+		}
+		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+		recordLogin(ctx, c, *foundUser, loginEvent)
+
+		respondWithTokens(c, signedInBody(*foundUser, gin.H{
+			"message":  "Login successful",
+			"provider": flow.Provider,
+			"scope":    flow.Scope,
+		}), token, refreshToken)
+	})
+}
+
+// findOrProvisionUser finds the user owning an upstream identity or creates a new account
+// for it. Existing accounts are never taken over by an identity with the same email; their
+// owners link it with OIDCLink.
+func findOrProvisionUser(ctx context.Context, provider string, identity *helpers.OIDCIdentity) (*models.User, error) {
+	var foundUser models.User
+
+	// Already linked
+	err := userCollection.FindOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{
+		"provider": provider,
+		"subject":  identity.Subject,
+	}}}).Decode(&foundUser)
+	if err == nil && foundUser.Deleted_at != nil {
+		return nil, errOIDCAccountDeleted
+	}
+	if err == nil {
+		return &foundUser, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errOIDCUnverifiedEmail
+	}
+
+	// The email stays taken by a deleted account until it is purged
+	err = userCollection.FindOne(ctx, bson.M{"email": identity.Email}).Decode(&foundUser)
+	if err == nil && foundUser.Deleted_at != nil {
+		return nil, errOIDCAccountDeleted
+	}
+	if err == nil {
+		return nil, errOIDCAccountExists
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	link := models.FederatedIdentity{
+		Provider:  provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		Linked_at: time.Now().UTC(),
+	}
+
+	// Just-in-time provision a new account without a local password
+	firstName, lastName := identity.GivenName, identity.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(identity.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+	userType := "USER"
+	email := identity.Email
+	status := helpers.NewAccountStatus()
+
+	newUser := models.User{
+		ID:         primitive.NewObjectID(),
+		First_name: &firstName,
+		Last_name:  &lastName,
+		Email:      &email,
+		User_type:  &userType,
+		Status:     &status,
+		Identities: []models.FederatedIdentity{link},
+	}
+	newUser.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	newUser.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	newUser.User_id = newUser.ID.Hex()
+
+	// Insert user into database together with its created event
+	err = database.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := userCollection.InsertOne(ctx, newUser); err != nil {
+			return err
+		}
+		return helpers.WriteOutboxEvent(ctx, helpers.EventUserCreated, newUser.User_id, helpers.UserEventData(newUser))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &newUser, nil
+}
+
+// linkIdentity adds an upstream identity to the account of userId, unless it already
+// belongs to another account
+func linkIdentity(ctx context.Context, userId string, provider string, identity *helpers.OIDCIdentity) error {
+	var owner models.User
+	err := userCollection.FindOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{
+		"provider": provider,
+		"subject":  identity.Subject,
+	}}}).Decode(&owner)
+	if err == nil && owner.User_id == userId {
+		return nil
+	}
+	if err == nil {
+		return errOIDCIdentityTaken
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	link := models.FederatedIdentity{
+		Provider:  provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		Linked_at: time.Now().UTC(),
+	}
+	result, err := userCollection.UpdateOne(ctx,
+		helpers.NotDeleted(bson.M{"user_id": userId}),
+		bson.M{"$push": bson.M{"identities": link}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errOIDCLinkUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// mockOIDCProvider is an upstream identity provider that signs in whoever the test says,
+// as long as the client redeems the code with the right PKCE verifier
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCGrant
+}
+
+// mockOIDCGrant is what an authorization code is redeemed for
+type mockOIDCGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	provider := &mockOIDCProvider{key: key, codes: map[string]mockOIDCGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := provider.server.URL
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		provider.mu.Lock()
+		grant, ok := provider.codes[r.FormValue("code")]
+		delete(provider.codes, r.FormValue("code"))
+		provider.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		idToken, err := provider.sign(grant.claims)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "upstream-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// sign returns an id_token carrying claims
+func (p *mockOIDCProvider) sign(claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		return "", err
+	}
+	payload, _ := json.Marshal(claims)
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+// authorize plays the user signing in at the provider: it answers the authorization URL
+// the client redirected to with a code for an identity with the given email
+func (p *mockOIDCProvider) authorize(t *testing.T, authURL string, clientID string, subject string, email string) (state string, code string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, p.server.URL+"/authorize") {
+		t.Fatalf("authorization URL %q does not point at the provider", authURL)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	now := time.Now()
+	code, _ = helpers.RandomString(16)
+	p.mu.Lock()
+	p.codes[code] = mockOIDCGrant{
+		challenge: query.Get("code_challenge"),
+		claims: map[string]interface{}{
+			"iss":            p.server.URL,
+			"sub":            subject,
+			"aud":            clientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          query.Get("nonce"),
+			"email":          email,
+			"email_verified": true,
+		},
+	}
+	p.mu.Unlock()
+	return query.Get("state"), code
+}
+
+// useMockOIDCProvider configures name as an upstream provider backed by the mock. Discovered
+// providers are kept for the life of the process, so every test needs a name of its own.
+func useMockOIDCProvider(t *testing.T, name string) *mockOIDCProvider {
+	provider := newMockOIDCProvider(t)
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	t.Setenv("OIDC_PROVIDERS", name)
+	t.Setenv(prefix+"ISSUER", provider.server.URL)
+	t.Setenv(prefix+"CLIENT_ID", "test-client")
+	t.Setenv(prefix+"REDIRECT_URL", "https://app.example.com/auth/oidc/"+name+"/callback")
+	helpers.InitializeOIDCHelper()
+	helpers.SECRET_KEY = "test-secret"
+	return provider
+}
+
+// oidcTestRouter serves the OIDC routes, with the link route signed in as uid
+func oidcTestRouter(uid string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/login", OIDCLogin())
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback())
+	router.POST("/auth/oidc/:provider/link", func(c *gin.Context) {
+		c.Set("uid", uid)
+	}, OIDCLink())
+	return router
+}
+
+// finishOIDCFlow signs in at the mock provider and returns the response of the callback
+func finishOIDCFlow(t *testing.T, router *gin.Engine, provider *mockOIDCProvider, name string, start *httptest.ResponseRecorder, authURL string, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	state, code := provider.authorize(t, authURL, "test-client", "upstream-subject", email)
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/"+name+"/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	for _, cookie := range start.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCCallbackRefusesToTakeOverExistingAccount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("admin with the same email", func(mt *mtest.T) {
+		t := mt.T
+		provider := useMockOIDCProvider(t, "takeover")
+		userCollection = mt.Coll
+		t.Cleanup(func() { userCollection = nil })
+		router := oidcTestRouter("")
+
+		start := httptest.NewRecorder()
+		router.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/auth/oidc/takeover/login", nil))
+		if start.Code != http.StatusFound {
+			t.Fatalf("login status = %d, want %d: %s", start.Code, http.StatusFound, start.Body)
+		}
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			// No account is linked to the identity yet
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch),
+			// But an admin has the same email address
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+				{Key: "user_id", Value: "admin-1"},
+				{Key: "email", Value: "admin@example.com"},
+				{Key: "user_type", Value: "ADMIN"},
+			}),
+		)
+
+		w := finishOIDCFlow(t, router, provider, "takeover", start, start.Header().Get("Location"), "admin@example.com")
+		if w.Code != http.StatusConflict {
+			t.Fatalf("callback status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "token") {
+			t.Fatalf("callback issued tokens: %s", w.Body)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "find" {
+				t.Fatalf("callback ran %s, want only lookups", event.CommandName)
+			}
+		}
+	})
+}
+
+func TestOIDCLinkLinksIdentityToSignedInUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("signed in user", func(mt *mtest.T) {
+		t := mt.T
+		provider := useMockOIDCProvider(t, "link")
+		userCollection = mt.Coll
+		t.Cleanup(func() { userCollection = nil })
+		router := oidcTestRouter("user-1")
+
+		start := httptest.NewRecorder()
+		router.ServeHTTP(start, httptest.NewRequest(http.MethodPost, "/auth/oidc/link/link", nil))
+		if start.Code != http.StatusOK {
+			t.Fatalf("link status = %d, want %d: %s", start.Code, http.StatusOK, start.Body)
+		}
+		var body struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		if err := json.Unmarshal(start.Body.Bytes(), &body); err != nil {
+			t.Fatalf("link body: %v", err)
+		}
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		// The identity's email differs from the account's, linking goes by the session
+		w := finishOIDCFlow(t, router, provider, "link", start, body.AuthorizationURL, "someone@example.org")
+		if w.Code != http.StatusOK {
+			t.Fatalf("callback status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+
+		update := mt.GetStartedEvent()
+		for update != nil && update.CommandName != "update" {
+			update = mt.GetStartedEvent()
+		}
+		if update == nil {
+			t.Fatal("callback did not update the user")
+		}
+		statement := update.Command.Lookup("updates", "0")
+		if userId := statement.Document().Lookup("q", "user_id").StringValue(); userId != "user-1" {
+			t.Fatalf("linked user = %q, want user-1", userId)
+		}
+		if subject := statement.Document().Lookup("u", "$push", "identities", "subject").StringValue(); subject != "upstream-subject" {
+			t.Fatalf("linked subject = %q, want upstream-subject", subject)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tokenCollection *mongo.Collection
+
+// createTokenRequest is the body accepted by CreateToken
+type createTokenRequest struct {
+	Name       string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes     []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	Expires_at *time.Time `json:"expires_at"`
+}
+
+// InitializeTokenController initializes the package variables after DB connection
+func InitializeTokenController() {
+	tokenCollection = database.GetCollection("personal_access_tokens")
+}
+
+// CreateToken creates a personal access token for the user and returns it once
+func CreateToken() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if tokenCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Users may only create tokens for themselves, and not by using another token of this kind
+		if c.GetString("uid") != userId {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized to access this resource",
+			})
+			return
+		}
+		if c.GetString("auth_method") == "pat" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Personal access tokens cannot be used to create new tokens",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request createTokenRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+		// A token can never grant more than the credential creating it
+		scopes, err := helpers.NarrowTokenScopes(request.Scopes, c.GetStringSlice("scopes"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if request.Expires_at != nil && !request.Expires_at.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "expires_at must be in the future",
+			})
+			return
+		}
+
+		// Generate the secret
+		plainToken, hash, prefix, err := helpers.GeneratePersonalAccessToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating the token",
+			})
+			return
+		}
+
+		pat := models.PersonalAccessToken{
+			ID:           primitive.NewObjectID(),
+			User_id:      userId,
+			Name:         request.Name,
+			Scopes:       scopes,
+			Token_hash:   hash,
+			Token_prefix: prefix,
+			Created_at:   time.Now().UTC(),
+			Expires_at:   request.Expires_at,
+		}
+		pat.Token_id = pat.ID.Hex()
+
+		if _, err := tokenCollection.InsertOne(ctx, pat); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Token was not created",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditTokenCreate, TargetType: "token", TargetID: pat.Token_id, Reason: pat.Name, Changes: map[string]string{"scopes": strings.Join(pat.Scopes, " ")}})
+
+		// The plain token is only ever returned here
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Token created successfully",
+			"token":          plainToken,
+			"token_metadata": pat,
+		})
+	})
+}
+
+// GetTokens lists the personal access tokens of a user without their secrets
+func GetTokens() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if tokenCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is authorized to access this user data
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := tokenCollection.Find(ctx, bson.M{"user_id": userId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing tokens",
+			})
+			return
+		}
+
+		tokens := []models.PersonalAccessToken{}
+		if err := cursor.All(ctx, &tokens); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing tokens",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"tokens": tokens,
+		})
+	})
+}
+
+// RevokeToken revokes one of a user's personal access tokens
+func RevokeToken() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if tokenCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+		tokenId := c.Param("token_id")
+
+		// Check if user is authorized to update this user data
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := tokenCollection.UpdateOne(ctx,
+			bson.M{"token_id": tokenId, "user_id": userId, "revoked_at": nil},
+			bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while revoking the token",
+			})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Token not found",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditTokenRevoke, TargetType: "token", TargetID: tokenId})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Token revoked successfully",
+		})
+	})
+}
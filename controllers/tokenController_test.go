@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateTokenStaysWithinSessionScopes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty scope", body: `{"name":"ci","scopes":[""]}`},
+		{name: "no scopes", body: `{"name":"ci","scopes":[]}`},
+		{name: "scope beyond the session", body: `{"name":"ci","scopes":["users:delete"]}`},
+		{name: "unknown scope", body: `{"name":"ci","scopes":["users:everything"]}`},
+	}
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			tokenCollection = mt.Coll
+			mt.Cleanup(func() { tokenCollection = nil })
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/users/:user_id/tokens", func(c *gin.Context) {
+				// A session narrowed to reading users
+				c.Set("uid", "user-1")
+				c.Set("scopes", []string{helpers.ScopeUsersRead})
+			}, CreateToken())
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/users/user-1/tokens", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				mt.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+			if events := mt.GetAllStartedEvents(); len(events) != 0 {
+				mt.Fatalf("token was stored: %s", events[0].CommandName)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,7 +27,10 @@ func InitializeUserController() {
 	userCollection = database.GetCollection("users")
 }
 
-// GetUsers retrieves all users (Admin only)
+// GetUsers lists users a page at a time (Admin only). The users can be filtered as described
+// at userListFilter and ordered by ?sort= and ?order=asc|desc, oldest first by default.
+// Pages are picked by ?page= or, for deep pages, by the ?cursor= of the next or previous
+// link of an earlier page.
 func GetUsers() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// Ensure initialization
@@ -47,35 +54,54 @@ func GetUsers() gin.HandlerFunc {
 		// Get pagination parameters
 		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
 		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
+			recordPerPage = helpers.UserPageDefaultSize
+		}
+		if recordPerPage > helpers.UserPageMaxSize {
+			recordPerPage = helpers.UserPageMaxSize
 		}
 
 		page, err := strconv.Atoi(c.Query("page"))
 		if err != nil || page < 1 {
 			page = 1
 		}
+		cursor := c.Query("cursor")
 
-		startIndex := (page - 1) * recordPerPage
+		filter, err := userListFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
-		// Create aggregation pipeline
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}}}}
-		groupStage := bson.D{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: bson.D{{Key: "_id", Value: "null"}}},
-			{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-			{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-		}}}
-		projectStage := bson.D{
-			{Key: "$project", Value: bson.D{
-				{Key: "_id", Value: 0},
-				{Key: "total_count", Value: 1},
-				{Key: "user_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}}}},
-			}},
+		sort := helpers.DefaultUserSort
+		if field := c.Query("sort"); field != "" {
+			if !slices.Contains(helpers.UserSortFields, field) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "sort must be one of " + strings.Join(helpers.UserSortFields, ", "),
+				})
+				return
+			}
+			sort.Field = field
+		}
+		switch c.DefaultQuery("order", "asc") {
+		case "asc":
+		case "desc":
+			sort.Order = -1
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "order must be asc or desc",
+			})
+			return
 		}
 
-		// Execute aggregation
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
+		result, err := helpers.ListUsers(ctx, filter, sort, recordPerPage, page, cursor)
+		if err == helpers.ErrInvalidPageCursor {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Error occurred while listing user items",
@@ -83,30 +109,101 @@ func GetUsers() gin.HandlerFunc {
 			return
 		}
 
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			log.Fatal(err)
-		}
-
 		// Return users data
-		if len(allUsers) > 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"total_count": allUsers[0]["total_count"],
-				"users":       allUsers[0]["user_items"],
-				"page":        page,
-				"per_page":    recordPerPage,
-			})
-		} else {
-			c.JSON(http.StatusOK, gin.H{
-				"total_count": 0,
-				"users":       []interface{}{},
-				"page":        page,
-				"per_page":    recordPerPage,
-			})
+		response := gin.H{
+			"total_count": result.Total,
+			"users":       result.Users,
+			"per_page":    recordPerPage,
+			"next_cursor": result.Next_cursor,
+			"prev_cursor": result.Prev_cursor,
+			"links":       userPageLinks(c, result),
 		}
+		if cursor == "" {
+			response["page"] = page
+		}
+		c.JSON(http.StatusOK, response)
 	})
 }
 
+// userListFilter builds the user filter shared by the user list and export from the query
+// string: ?user_type=, ?status=, prefixes of ?email=, ?phone= and ?name= (first or last
+// name, ignoring case), ?created_from=, ?created_to=, ?updated_from=, ?updated_to= as
+// RFC 3339 timestamps and a full-text search with ?q=. Deleted users are left out, or
+// with ?deleted=true are the only users matched.
+func userListFilter(c *gin.Context) (bson.M, error) {
+	conditions := []bson.M{helpers.NotDeleted(bson.M{})}
+	if c.Query("deleted") == "true" {
+		conditions[0] = bson.M{"deleted_at": bson.M{"$ne": nil}}
+	}
+
+	if userType := c.Query("user_type"); userType != "" {
+		if userType != "ADMIN" && userType != "USER" {
+			return nil, errors.New("user_type must be ADMIN or USER")
+		}
+		conditions = append(conditions, bson.M{"user_type": userType})
+	}
+
+	if status := c.Query("status"); status != "" {
+		if !slices.Contains(helpers.AccountStatuses, status) {
+			return nil, errors.New("status must be one of " + strings.Join(helpers.AccountStatuses, ", "))
+		}
+		conditions = append(conditions, helpers.UserStatusFilter(status))
+	}
+
+	for _, param := range []string{"email", "phone"} {
+		if prefix := c.Query(param); prefix != "" {
+			conditions = append(conditions, bson.M{param: bson.M{"$regex": "^" + regexp.QuoteMeta(prefix), "$options": "i"}})
+		}
+	}
+	if prefix := c.Query("name"); prefix != "" {
+		pattern := bson.M{"$regex": "^" + regexp.QuoteMeta(prefix), "$options": "i"}
+		conditions = append(conditions, bson.M{"$or": []bson.M{{"first_name": pattern}, {"last_name": pattern}}})
+	}
+
+	for _, field := range []string{"created", "updated"} {
+		bounds := bson.M{}
+		for suffix, operator := range map[string]string{"_from": "$gte", "_to": "$lt"} {
+			raw := c.Query(field + suffix)
+			if raw == "" {
+				continue
+			}
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, errors.New(field + suffix + " must be an RFC 3339 timestamp")
+			}
+			bounds[operator] = value
+		}
+		if len(bounds) > 0 {
+			conditions = append(conditions, bson.M{field + "_at": bounds})
+		}
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		conditions = append(conditions, bson.M{"$text": bson.M{"$search": q}})
+	}
+
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return bson.M{"$and": conditions}, nil
+}
+
+// userPageLinks returns the URLs of the pages around a page of the user list, keeping
+// the other query parameters of the request
+func userPageLinks(c *gin.Context, result *helpers.UserPage) gin.H {
+	links := gin.H{}
+	for rel, cursor := range map[string]string{"next": result.Next_cursor, "prev": result.Prev_cursor} {
+		if cursor == "" {
+			continue
+		}
+		query := c.Request.URL.Query()
+		query.Del("page")
+		query.Set("cursor", cursor)
+		links[rel] = c.Request.URL.Path + "?" + query.Encode()
+	}
+	return links
+}
+
 // GetUser retrieves a single user by ID
 func GetUser() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -130,10 +227,17 @@ func GetUser() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		// Admins see how the account is managed, users only their profile
+		isAdmin := helpers.CheckUserType(c, "ADMIN") == nil
+		projection := helpers.UserProfileProjection
+		if isAdmin {
+			projection = helpers.UserRecordProjection
+		}
+
 		var user models.User
 
 		// Find user by user_id
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": userId}), options.FindOne().SetProjection(projection)).Decode(&user)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "User not found",
@@ -141,18 +245,28 @@ func GetUser() gin.HandlerFunc {
 			return
 		}
 
-		// Remove sensitive information before sending response
-		user.Password = nil
-		user.Token = nil
-		user.Refresh_token = nil
-
 		// Return user data
+		if isAdmin {
+			c.JSON(http.StatusOK, gin.H{
+				"user": helpers.NewUserRecord(user),
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"user": user,
+			"user": helpers.NewUserProfile(user),
 		})
 	})
 }
 
+// updateUserRequest is the body accepted by UpdateUser. Fields left out keep their value.
+type updateUserRequest struct {
+	First_name *string `json:"first_name" validate:"omitempty,min=2,max=100"`
+	Last_name  *string `json:"last_name" validate:"omitempty,min=2,max=100"`
+	Email      *string `json:"email" validate:"omitempty,email"`
+	Phone      *string `json:"phone"`
+	Password   *string `json:"password" validate:"omitempty,min=6"`
+}
+
 // UpdateUser updates user information
 func UpdateUser() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -176,25 +290,50 @@ func UpdateUser() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		var updateUser models.User
+		var updateUser updateUserRequest
+		if !bindRequest(c, &updateUser) {
+			return
+		}
 
-		// Bind JSON request to user struct
-		if err := c.BindJSON(&updateUser); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": err.Error(),
+		// Load the current values to summarize the change in the audit log
+		var existingUser models.User
+		if err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": userId})).Decode(&existingUser); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
 			})
 			return
 		}
+		changes := map[string]string{}
 
 		// Create update document
 		var updateObj primitive.D
 
+		// The email and password sign in to the account, so changing either is not allowed
+		// while impersonating and requires a recent login or re-authentication
+		if updateUser.Email != nil || updateUser.Password != nil {
+			if err := helpers.CheckNotImpersonated(c); err != nil {
+				helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserUpdate, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+
+			if err := helpers.CheckRecentAuth(c, helpers.StepUpMaxAge); err != nil {
+				helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserUpdate, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+				helpers.AbortInsufficientAuthentication(c, helpers.StepUpMaxAge, err.Error())
+				return
+			}
+		}
+
 		if updateUser.First_name != nil {
 			updateObj = append(updateObj, bson.E{Key: "first_name", Value: updateUser.First_name})
+			describeChange(changes, "first_name", existingUser.First_name, updateUser.First_name)
 		}
 
 		if updateUser.Last_name != nil {
 			updateObj = append(updateObj, bson.E{Key: "last_name", Value: updateUser.Last_name})
+			describeChange(changes, "last_name", existingUser.Last_name, updateUser.Last_name)
 		}
 
 		if updateUser.Email != nil {
@@ -216,9 +355,15 @@ func UpdateUser() gin.HandlerFunc {
 				return
 			}
 			updateObj = append(updateObj, bson.E{Key: "email", Value: updateUser.Email})
+			describeChange(changes, "email", existingUser.Email, updateUser.Email)
 		}
 
-		if updateUser.Phone != nil {
+		if updateUser.Phone != nil && *updateUser.Phone == "" {
+			// An empty phone number removes it, leaving the account like those provisioned
+			// by an identity provider
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: nil})
+			describeChange(changes, "phone", existingUser.Phone, updateUser.Phone)
+		} else if updateUser.Phone != nil {
 			// Check if phone already exists for another user
 			count, err := userCollection.CountDocuments(ctx, bson.M{
 				"phone":   updateUser.Phone,
@@ -237,12 +382,15 @@ func UpdateUser() gin.HandlerFunc {
 				return
 			}
 			updateObj = append(updateObj, bson.E{Key: "phone", Value: updateUser.Phone})
+			describeChange(changes, "phone", existingUser.Phone, updateUser.Phone)
 		}
 
 		if updateUser.Password != nil {
 			// Hash the new password
 			hashedPassword := HashPassword(*updateUser.Password)
 			updateObj = append(updateObj, bson.E{Key: "password", Value: hashedPassword})
+			updateObj = append(updateObj, bson.E{Key: "password_reset_required", Value: false})
+			changes["password"] = "changed"
 		}
 
 		// Set updated timestamp
@@ -255,12 +403,29 @@ func UpdateUser() gin.HandlerFunc {
 			Upsert: &upsert,
 		}
 
-		result, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"user_id": userId},
-			bson.D{{Key: "$set", Value: updateObj}},
-			&opt,
-		)
+		// Subscribers learn which fields changed, but not to what
+		changedFields := slices.Sorted(maps.Keys(changes))
+
+		var result *mongo.UpdateResult
+		err := database.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = userCollection.UpdateOne(
+				ctx,
+				helpers.NotDeleted(bson.M{"user_id": userId}),
+				bson.D{{Key: "$set", Value: updateObj}},
+				&opt,
+			)
+			if err != nil || result.MatchedCount == 0 || len(changes) == 0 {
+				return err
+			}
+			if err := helpers.WriteOutboxEvent(ctx, helpers.EventUserUpdated, userId, gin.H{"user_id": userId, "changed_fields": changedFields}); err != nil {
+				return err
+			}
+			if _, ok := changes["email"]; ok {
+				return helpers.WriteOutboxEvent(ctx, helpers.EventUserEmailChanged, userId, gin.H{"user_id": userId, "old_email": existingUser.Email, "new_email": updateUser.Email})
+			}
+			return nil
+		})
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -276,13 +441,16 @@ func UpdateUser() gin.HandlerFunc {
 			return
 		}
 
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserUpdate, TargetType: "user", TargetID: userId, Changes: changes})
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "User updated successfully",
 		})
 	})
 }
 
-// DeleteUser deletes a user (Admin only)
+// DeleteUser soft deletes a user (Admin only). The user's sessions and personal access
+// tokens are revoked at once; the account can be restored until the purge job removes it.
 func DeleteUser() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// Ensure initialization
@@ -296,6 +464,7 @@ func DeleteUser() gin.HandlerFunc {
 
 		// Check if user is admin
 		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserDelete, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": err.Error(),
 			})
@@ -305,8 +474,35 @@ func DeleteUser() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Delete the user
-		result, err := userCollection.DeleteOne(ctx, bson.M{"user_id": userId})
+		deletedAt := time.Now().UTC()
+		deletedBy := c.GetString("uid")
+		purgeAt := helpers.UserPurgeAt(deletedAt)
+
+		// Mark the user deleted and revoke their tokens together with writing the events
+		var result *mongo.UpdateResult
+		err := database.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = userCollection.UpdateOne(ctx,
+				helpers.NotDeleted(bson.M{"user_id": userId}),
+				bson.M{"$set": bson.M{
+					"deleted_at":    deletedAt,
+					"deleted_by":    deletedBy,
+					"token":         nil,
+					"refresh_token": nil,
+					"updated_at":    deletedAt,
+				}},
+			)
+			if err != nil || result.MatchedCount == 0 {
+				return err
+			}
+			if err := helpers.RevokePersonalAccessTokens(ctx, userId); err != nil {
+				return err
+			}
+			if err := helpers.WriteOutboxEvent(ctx, helpers.EventSessionRevoked, userId, gin.H{"user_id": userId, "reason": "user_deleted"}); err != nil {
+				return err
+			}
+			return helpers.WriteOutboxEvent(ctx, helpers.EventUserDeleted, userId, gin.H{"user_id": userId, "deleted_by": deletedBy, "purge_at": purgeAt})
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Error occurred while deleting user",
@@ -314,15 +510,393 @@ func DeleteUser() gin.HandlerFunc {
 			return
 		}
 
-		if result.DeletedCount == 0 {
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+
+		helpers.InvalidateUserState(userId)
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserDelete, TargetType: "user", TargetID: userId})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  fmt.Sprintf("User %s deleted successfully", userId),
+			"purge_at": purgeAt,
+		})
+	})
+}
+
+// RestoreUser undoes the soft delete of a user that has not been purged or erased yet (Admin only).
+// Revoked sessions and personal access tokens stay revoked.
+func RestoreUser() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserRestore, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var result *mongo.UpdateResult
+		err := database.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = userCollection.UpdateOne(ctx,
+				bson.M{"user_id": userId, "deleted_at": bson.M{"$ne": nil}, "erased_at": nil},
+				bson.M{
+					"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+					"$set":   bson.M{"updated_at": time.Now().UTC()},
+				},
+			)
+			if err != nil || result.MatchedCount == 0 {
+				return err
+			}
+			return helpers.WriteOutboxEvent(ctx, helpers.EventUserRestored, userId, gin.H{"user_id": userId, "restored_by": c.GetString("uid")})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while restoring user",
+			})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Deleted user not found",
+			})
+			return
+		}
+
+		helpers.InvalidateUserState(userId)
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserRestore, TargetType: "user", TargetID: userId})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("User %s restored successfully", userId),
+		})
+	})
+}
+
+// suspendRequest is the body accepted by SuspendUser
+type suspendRequest struct {
+	Status string     `json:"status" validate:"omitempty,oneof=suspended locked"`
+	Reason string     `json:"reason" validate:"required,max=500"`
+	Until  *time.Time `json:"until"`
+}
+
+// reinstateRequest is the optional body accepted by ReinstateUser
+type reinstateRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// SuspendUser suspends or locks an account, optionally until a given time, and ends its
+// sessions (Admin only). The user cannot sign in or use their tokens until reinstated.
+func SuspendUser() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserSuspend, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		var request suspendRequest
+		if !bindRequest(c, &request) {
+			return
+		}
+		if request.Status == "" {
+			request.Status = helpers.StatusSuspended
+		}
+		if request.Until != nil && !request.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "until must be in the future",
+			})
+			return
+		}
+
+		// Admins cannot lock themselves out
+		if userId == c.GetString("uid") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "You cannot suspend your own account",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var existingUser models.User
+		if err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": userId})).Decode(&existingUser); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		previous := helpers.UserAccountStatus(existingUser)
+
+		eventData := gin.H{"user_id": userId, "status": request.Status, "until": request.Until}
+		err := database.WithTransaction(ctx, func(ctx context.Context) error {
+			if _, err := helpers.SetAccountStatus(ctx, userId, request.Status, request.Reason, request.Until, c.GetString("uid")); err != nil {
+				return err
+			}
+			if err := helpers.WriteOutboxEvent(ctx, helpers.EventSessionRevoked, userId, gin.H{"user_id": userId, "reason": "account_" + request.Status}); err != nil {
+				return err
+			}
+			return helpers.WriteOutboxEvent(ctx, helpers.EventUserSuspended, userId, eventData)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while suspending user",
+			})
+			return
+		}
+
+		helpers.InvalidateUserState(userId)
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserSuspend, TargetType: "user", TargetID: userId, Reason: request.Reason, Changes: map[string]string{"status": previous + " -> " + request.Status}})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("User %s is now %s", userId, request.Status),
+			"status":  request.Status,
+			"until":   request.Until,
+		})
+	})
+}
+
+// ReinstateUser makes a suspended, locked or pending account active again (Admin only)
+func ReinstateUser() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserReinstate, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// The reason is optional, and so is the body
+		var request reinstateRequest
+		if c.Request.ContentLength != 0 {
+			if !bindRequest(c, &request) {
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var existingUser models.User
+		if err := userCollection.FindOne(ctx, helpers.NotDeleted(bson.M{"user_id": userId})).Decode(&existingUser); err != nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "User not found",
 			})
 			return
 		}
+		previous := helpers.UserAccountStatus(existingUser)
+		if previous == helpers.StatusActive {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "User is already active",
+			})
+			return
+		}
+
+		err := database.WithTransaction(ctx, func(ctx context.Context) error {
+			if _, err := helpers.SetAccountStatus(ctx, userId, helpers.StatusActive, request.Reason, nil, c.GetString("uid")); err != nil {
+				return err
+			}
+			return helpers.WriteOutboxEvent(ctx, helpers.EventUserReinstated, userId, gin.H{"user_id": userId, "previous_status": previous})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while reinstating user",
+			})
+			return
+		}
+
+		helpers.InvalidateUserState(userId)
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserReinstate, TargetType: "user", TargetID: userId, Reason: request.Reason, Changes: map[string]string{"status": previous + " -> " + helpers.StatusActive}})
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("User %s deleted successfully", userId),
+			"message": fmt.Sprintf("User %s reinstated successfully", userId),
+			"status":  helpers.StatusActive,
 		})
 	})
 }
+
+// eraseRequest is the body accepted by EraseUser
+type eraseRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// EraseUser irreversibly anonymizes a user for a right-to-erasure request and returns the
+// certificate of erasure (Admin only). Unlike DeleteUser it cannot be undone.
+func EraseUser() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserErase, Outcome: helpers.AuditDenied, TargetType: "user", TargetID: userId, Reason: err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		var request eraseRequest
+		if !bindRequest(c, &request) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		certificate, err := helpers.EraseUser(ctx, userId, c.GetString("uid"), request.Reason)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+		if err == helpers.ErrUserAlreadyErased {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while erasing user",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserErase, TargetType: "user", TargetID: userId, Reason: "certificate " + certificate.Certificate_id + " sha256:" + certificate.Hash})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     fmt.Sprintf("User %s erased successfully", userId),
+			"certificate": certificate,
+		})
+	})
+}
+
+// GetErasureCertificate returns the certificate of erasure of an erased user (Admin only)
+func GetErasureCertificate() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		userId := c.Param("user_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		certificate, err := helpers.GetErasureCertificate(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Erasure certificate not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"certificate": certificate,
+		})
+	})
+}
+
+// GetLoginHistory lists the most recent logins of a user with their risk assessment
+func GetLoginHistory() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		events, err := helpers.GetLoginEvents(ctx, userId, int64(limit))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing logins",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"logins": events,
+		})
+	})
+}
+
+// describeChange adds a "old -> new" summary of a changed field to changes
+func describeChange(changes map[string]string, field string, from *string, to *string) {
+	if to == nil {
+		return
+	}
+
+	var old string
+	if from != nil {
+		old = *from
+	}
+	if old == *to {
+		return
+	}
+	changes[field] = old + " -> " + *to
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpdateUserWithoutPhone(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("accounts from an identity provider", func(mt *mtest.T) {
+		previous := database.DB
+		database.DB = database.DBInstance{Client: mt.Client, DB: mt.DB}
+		userCollection = mt.Coll
+		mt.Cleanup(func() {
+			database.DB = previous
+			userCollection = nil
+		})
+
+		// The outbox indexes, then transaction support, which the mock server lacks
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		helpers.InitializeOutboxHelper()
+		database.SupportsTransactions(context.Background())
+
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.PATCH("/users/:user_id", func(c *gin.Context) {
+			c.Set("uid", "user-1")
+			c.Set("user_type", "USER")
+		}, UpdateUser())
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		oidcUser := bson.D{{Key: "user_id", Value: "user-1"}, {Key: "first_name", Value: "Ada"}, {Key: "email", Value: "ada@example.com"}}
+		phoneUser := append(slices.Clone(oidcUser), bson.E{Key: "phone", Value: "+15550100"})
+		updated := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+		tests := []struct {
+			name     string
+			stored   bson.D
+			body     string
+			commands []string
+			phone    bsontype.Type // type of the phone set by the update, 0 when left alone
+		}{
+			{name: "rename", stored: oidcUser, body: `{"first_name":"Grace"}`, commands: []string{"find", "update", "insert"}},
+			{name: "empty phone", stored: oidcUser, body: `{"phone":""}`, commands: []string{"find", "update"}, phone: bson.TypeNull},
+			{name: "remove phone", stored: phoneUser, body: `{"phone":""}`, commands: []string{"find", "update", "insert"}, phone: bson.TypeNull},
+			{name: "add phone", stored: oidcUser, body: `{"phone":"+15550101"}`, commands: []string{"find", "aggregate", "update", "insert"}, phone: bson.TypeString},
+		}
+		for _, test := range tests {
+			mt.ClearEvents()
+			var responses []bson.D
+			for _, command := range test.commands {
+				switch command {
+				case "find":
+					responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, test.stored))
+				case "aggregate":
+					responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{{Key: "n", Value: 0}}))
+				case "update":
+					responses = append(responses, updated)
+				default:
+					responses = append(responses, mtest.CreateSuccessResponse())
+				}
+			}
+			mt.AddMockResponses(responses...)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/users/user-1", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				mt.Fatalf("%s: status = %d, want %d: %s", test.name, w.Code, http.StatusOK, w.Body)
+			}
+
+			var commands []string
+			var update bson.Raw
+			for _, event := range mt.GetAllStartedEvents() {
+				commands = append(commands, event.CommandName)
+				if event.CommandName == "update" {
+					update = event.Command
+				}
+			}
+			if command := strings.Join(commands, ","); command != strings.Join(test.commands, ",") {
+				mt.Fatalf("%s: commands = %s, want %s", test.name, command, strings.Join(test.commands, ","))
+			}
+			if phone := update.Lookup("updates", "0", "u", "$set", "phone").Type; phone != test.phone {
+				mt.Fatalf("%s: phone set as %v, want %v", test.name, phone, test.phone)
+			}
+		}
+	})
+}
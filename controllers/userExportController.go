@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// ExportUsers streams every user as CSV or NDJSON (?format=ndjson) without passwords or
+// tokens (Admin only). The users can be narrowed down with the filters of GetUsers.
+func ExportUsers() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if userCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", helpers.UserExportCSV)
+		if !helpers.ValidUserExportFormat(format) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "format must be csv or ndjson",
+			})
+			return
+		}
+
+		filter, err := userListFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// The export runs as long as the client keeps reading
+		ctx := c.Request.Context()
+
+		filename := "users-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+		c.Header("Content-Type", helpers.UserExportContentType(format))
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		count, err := helpers.StreamUsers(ctx, c.Writer, format, filter)
+		if err != nil {
+			// The status line is already sent, so the truncated download is all the client sees
+			log.Println("Error occurred while exporting users:", err)
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserBulkExport, Outcome: helpers.AuditFailure, TargetType: "user", Reason: fmt.Sprintf("stopped after %d users: %v", count, err)})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditUserBulkExport, TargetType: "user", Reason: fmt.Sprintf("exported %d users as %s", count, format)})
+	})
+}
@@ -0,0 +1,473 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+)
+
+// finishRegistrationRequest is the body accepted by FinishPasskeyRegistration
+type finishRegistrationRequest struct {
+	Session_id string          `json:"session_id" validate:"required"`
+	Name       string          `json:"name" validate:"max=100"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+// beginPasskeyLoginRequest is the optional body accepted by BeginPasskeyLogin
+type beginPasskeyLoginRequest struct {
+	Scope string `json:"scope"`
+}
+
+// finishLoginRequest is the body accepted by FinishPasskeyLogin
+type finishLoginRequest struct {
+	Session_id string          `json:"session_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create (own account only)
+func BeginPasskeyRegistration() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Users may only register passkeys for themselves from a login session
+		if c.GetString("uid") != userId {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized to access this resource",
+			})
+			return
+		}
+		if c.GetString("auth_method") == "pat" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Personal access tokens cannot be used to register passkeys",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, err := helpers.FindWebAuthnUser(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+
+		// Prefer discoverable credentials so the passkey also works for passwordless login
+		creation, sessionData, err := helpers.WebAuthn.BeginRegistration(user,
+			webauthn.WithExclusions(user.CredentialDescriptors()),
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while starting passkey registration",
+			})
+			return
+		}
+
+		sessionId, err := helpers.SaveWebAuthnSession(ctx, userId, helpers.WebAuthnRegistration, "", "", sessionData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while starting passkey registration",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"session_id": sessionId,
+			"options":    creation,
+		})
+	})
+}
+
+// FinishPasskeyRegistration verifies the authenticator response and stores the new credential
+func FinishPasskeyRegistration() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		if c.GetString("uid") != userId {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized to access this resource",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request finishRegistrationRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+
+		session, sessionData, err := helpers.ConsumeWebAuthnSession(ctx, request.Session_id, helpers.WebAuthnRegistration)
+		if err != nil || session.User_id != userId {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The registration session is invalid or has expired",
+			})
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(request.Credential))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid credential: " + err.Error(),
+			})
+			return
+		}
+
+		user, err := helpers.FindWebAuthnUser(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+			return
+		}
+
+		credential, err := helpers.WebAuthn.CreateCredential(user, *sessionData, parsed)
+		if err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditPasskeyRegister, Outcome: helpers.AuditFailure, TargetType: "user", TargetID: userId, Reason: err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Passkey registration failed: " + err.Error(),
+			})
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			name = "Passkey"
+		}
+
+		stored, err := helpers.SaveWebAuthnCredential(ctx, userId, name, credential)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Passkey was not saved",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditPasskeyRegister, TargetType: "passkey", TargetID: stored.Credential_id, Reason: stored.Name})
+
+		c.JSON(http.StatusCreated, stored)
+	})
+}
+
+// GetPasskeys lists the passkeys registered by a user
+func GetPasskeys() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		user, err := helpers.LoadWebAuthnUser(ctx, models.User{User_id: userId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing passkeys",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"passkeys": user.Credentials,
+		})
+	})
+}
+
+// DeletePasskey removes a registered passkey
+func DeletePasskey() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		userId := c.Param("user_id")
+
+		// Check if user has permission to access this resource
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		deleted, err := helpers.DeleteWebAuthnCredential(ctx, userId, c.Param("credential_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while deleting the passkey",
+			})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkey not found",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditPasskeyDelete, TargetType: "passkey", TargetID: c.Param("credential_id")})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Passkey deleted successfully",
+		})
+	})
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get for a passwordless login
+func BeginPasskeyLogin() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// The body is optional
+		var request beginPasskeyLoginRequest
+		if c.Request.ContentLength != 0 {
+			if !bindRequest(c, &request) {
+				return
+			}
+		}
+		if _, err := helpers.NarrowScopes(request.Scope, helpers.AllScopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// The authenticator picks the account, so no email is needed and none is disclosed.
+		// Without a password the passkey has to verify the user itself.
+		assertion, sessionData, err := helpers.WebAuthn.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while starting passkey login",
+			})
+			return
+		}
+
+		sessionId, err := helpers.SaveWebAuthnSession(ctx, "", helpers.WebAuthnLogin, "", request.Scope, sessionData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while starting passkey login",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"session_id": sessionId,
+			"options":    assertion,
+		})
+	})
+}
+
+// FinishPasskeyLogin verifies an assertion and issues tokens. It finishes both passwordless
+// logins and password logins that were asked for a second factor.
+func FinishPasskeyLogin() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if helpers.WebAuthn == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Passkeys are not enabled",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request finishLoginRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+
+		jkt, ok := dpopThumbprint(c)
+		if !ok {
+			return
+		}
+
+		session, sessionData, err := helpers.ConsumeWebAuthnSession(ctx, request.Session_id, helpers.WebAuthnLogin, helpers.WebAuthnSecondFactor)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "The login session is invalid or has expired",
+			})
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(request.Credential))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid credential: " + err.Error(),
+			})
+			return
+		}
+
+		var user *helpers.WebAuthnUser
+		var credential *webauthn.Credential
+		if session.Purpose == helpers.WebAuthnSecondFactor {
+			// The password was already checked for this user
+			user, err = helpers.FindWebAuthnUser(ctx, session.User_id)
+			if err == nil {
+				credential, err = helpers.WebAuthn.ValidateLogin(user, *sessionData, parsed)
+			}
+		} else {
+			// The user handle returned by the authenticator names the account
+			credential, err = helpers.WebAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+				user, err = helpers.FindWebAuthnUser(ctx, string(userHandle))
+				return user, err
+			}, *sessionData, parsed)
+		}
+		if err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, ActorID: session.User_id, Reason: "passkey: " + err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Passkey verification failed",
+			})
+			return
+		}
+
+		if err := helpers.RecordWebAuthnAssertion(ctx, credential); err != nil {
+			helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditLogin, Outcome: helpers.AuditFailure, ActorID: user.User.User_id, Reason: "passkey: " + err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Passkey verification failed: " + err.Error(),
+			})
+			return
+		}
+
+		scopes, err := helpers.NarrowScopes(session.Scope, helpers.AllScopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		foundUser := user.User
+		if refuseInactiveAccount(c, foundUser, helpers.AuditLogin, "passkey") {
+			return
+		}
+
+		// Generate new JWT tokens
+		token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id,
+			helpers.WithScopes(scopes),
+			helpers.WithAuthTime(time.Now()),
+			helpers.WithConfirmation(jkt),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating tokens",
+			})
+			return
+		}
+
+		// Update tokens in database
+		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+
+		method := "passkey"
+		if session.Purpose == helpers.WebAuthnSecondFactor {
+			// Sessions started before the first factor was kept came from a password login
+			firstFactor := session.Method
+			if firstFactor == "" {
+				firstFactor = "password"
+			}
+			method = firstFactor + "+passkey"
+		}
+		recordLogin(ctx, c, foundUser, helpers.AssessLogin(ctx, foundUser.User_id, method, c.ClientIP(), c.Request.UserAgent()))
+
+		respondWithTokens(c, signedInBody(foundUser, gin.H{
+			"message":    "Login successful",
+			"scope":      strings.Join(scopes, " "),
+			"token_type": tokenType(jkt),
+		}), token, refreshToken)
+	})
+}
+
+// requireSecondFactor starts a passkey assertion when the user signed in by method has registered
+// a passkey and second factors are required, or force is set. It writes the challenge response,
+// or an error when the passkeys cannot be looked up, and returns true when the login must not go on.
+func requireSecondFactor(ctx context.Context, c *gin.Context, foundUser models.User, method string, scope string, force bool) bool {
+	if helpers.WebAuthn == nil || !(helpers.WebAuthnRequireSecondFactor || force) {
+		return false
+	}
+
+	// Without knowing the user's passkeys the login cannot go ahead on the password alone
+	user, err := helpers.LoadWebAuthnUser(ctx, foundUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error occurred while checking for passkeys",
+		})
+		return true
+	}
+	if len(user.Credentials) == 0 {
+		return false
+	}
+
+	assertion, sessionData, err := helpers.WebAuthn.BeginLogin(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error occurred while starting the passkey challenge",
+		})
+		return true
+	}
+
+	sessionId, err := helpers.SaveWebAuthnSession(ctx, foundUser.User_id, helpers.WebAuthnSecondFactor, method, scope, sessionData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error occurred while starting the passkey challenge",
+		})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Confirm the login with your passkey",
+		"mfa_required": true,
+		"session_id":   sessionId,
+		"options":      assertion,
+	})
+	return true
+}
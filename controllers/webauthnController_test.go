@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+)
+
+const (
+	testRPID     = "example.com"
+	testRPOrigin = "https://app.example.com"
+)
+
+// softAuthenticator is a software passkey holding one P-256 credential
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID, origin: testRPOrigin}
+}
+
+// authenticatorData builds the authenticator data for the relying party, with the
+// attested credential when attested is set
+func (a *softAuthenticator) authenticatorData(t *testing.T, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, publicKey...)
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	return data
+}
+
+// register answers a registration challenge with a "none" attestation
+func (a *softAuthenticator) register(t *testing.T, session *webauthn.SessionData) *protocol.ParsedCredentialCreationData {
+	t.Helper()
+	a.userHandle = session.UserID
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(t, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", session.Challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+			"transports":        []string{"internal"},
+		},
+	})
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("parsing the registration response: ", err)
+	}
+	return parsed
+}
+
+// assert signs a login challenge, counting the signature
+func (a *softAuthenticator) assert(t *testing.T, session *webauthn.SessionData) *protocol.ParsedCredentialAssertionData {
+	t.Helper()
+	a.signCount++
+	authData := a.authenticatorData(t, false)
+	clientData := a.clientData("webauthn.get", session.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("parsing the assertion response: ", err)
+	}
+	return parsed
+}
+
+// useTestRelyingParty enables passkeys for the duration of a test
+func useTestRelyingParty(t *testing.T) {
+	t.Helper()
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:                  testRPID,
+		RPDisplayName:         "Test",
+		RPOrigins:             []string{testRPOrigin},
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousSecondFactor := helpers.WebAuthn, helpers.WebAuthnRequireSecondFactor
+	helpers.WebAuthn, helpers.WebAuthnRequireSecondFactor = rp, true
+	t.Cleanup(func() {
+		helpers.WebAuthn, helpers.WebAuthnRequireSecondFactor = previous, previousSecondFactor
+	})
+}
+
+func testWebAuthnUser() *helpers.WebAuthnUser {
+	email, firstName, lastName := "ada@example.com", "Ada", "Lovelace"
+	return &helpers.WebAuthnUser{User: models.User{
+		User_id:    "64b000000000000000000001",
+		Email:      &email,
+		First_name: &firstName,
+		Last_name:  &lastName,
+	}}
+}
+
+// registerSoftAuthenticator runs a registration ceremony and stores the result on user
+func registerSoftAuthenticator(t *testing.T, user *helpers.WebAuthnUser) *softAuthenticator {
+	t.Helper()
+	_, session, err := helpers.WebAuthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	credential, err := helpers.WebAuthn.CreateCredential(user, *session, authenticator.register(t, session))
+	if err != nil {
+		t.Fatal("registration was rejected: ", err)
+	}
+	user.Credentials = append(user.Credentials, helpers.NewWebAuthnCredential(user.User.User_id, "Test key", credential))
+	return authenticator
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	authenticator := registerSoftAuthenticator(t, user)
+
+	stored := user.Credentials[0]
+	if stored.Credential_id != base64.RawURLEncoding.EncodeToString(authenticator.credentialID) {
+		t.Errorf("credential id = %q", stored.Credential_id)
+	}
+	if stored.Attestation_type != "none" {
+		t.Errorf("attestation type = %q, want none", stored.Attestation_type)
+	}
+	if len(stored.Transports) != 1 || stored.Transports[0] != "internal" {
+		t.Errorf("transports = %v", stored.Transports)
+	}
+	if len(stored.Public_key) == 0 {
+		t.Error("public key was not stored")
+	}
+}
+
+func TestPasskeyRegistrationRejectsForeignOrigin(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	_, session, err := helpers.WebAuthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := newSoftAuthenticator(t)
+	authenticator.origin = "https://phishing.example.net"
+	if _, err := helpers.WebAuthn.CreateCredential(user, *session, authenticator.register(t, session)); err == nil {
+		t.Fatal("registration from a foreign origin was accepted")
+	}
+}
+
+func TestPasskeySecondFactorLogin(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	authenticator := registerSoftAuthenticator(t, user)
+
+	_, session, err := helpers.WebAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := helpers.WebAuthn.ValidateLogin(user, *session, authenticator.assert(t, session))
+	if err != nil {
+		t.Fatal("assertion was rejected: ", err)
+	}
+	if credential.Authenticator.SignCount != authenticator.signCount {
+		t.Errorf("sign count = %d, want %d", credential.Authenticator.SignCount, authenticator.signCount)
+	}
+	if credential.Authenticator.CloneWarning {
+		t.Error("clone warning raised for an increasing counter")
+	}
+}
+
+func TestPasskeyDiscoverableLogin(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	authenticator := registerSoftAuthenticator(t, user)
+
+	_, session, err := helpers.WebAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []byte
+	_, err = helpers.WebAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		found = userHandle
+		return user, nil
+	}, *session, authenticator.assert(t, session))
+	if err != nil {
+		t.Fatal("assertion was rejected: ", err)
+	}
+	if string(found) != user.User.User_id {
+		t.Errorf("user handle = %q, want %q", found, user.User.User_id)
+	}
+}
+
+func TestPasskeyLoginDetectsClonedAuthenticator(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	authenticator := registerSoftAuthenticator(t, user)
+
+	// The stored counter is ahead of the authenticator, as after a copy was used
+	user.Credentials[0].Sign_count = 10
+	_, session, err := helpers.WebAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := helpers.WebAuthn.ValidateLogin(user, *session, authenticator.assert(t, session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := helpers.RecordWebAuthnAssertion(context.Background(), credential); err == nil {
+		t.Fatal("assertion from a cloned authenticator was recorded")
+	}
+}
+
+func TestPasskeyLoginRejectsOtherChallenge(t *testing.T) {
+	useTestRelyingParty(t)
+	user := testWebAuthnUser()
+	authenticator := registerSoftAuthenticator(t, user)
+
+	_, answered, err := helpers.WebAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, session, err := helpers.WebAuthn.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := helpers.WebAuthn.ValidateLogin(user, *session, authenticator.assert(t, answered)); err == nil {
+		t.Fatal("assertion for another challenge was accepted")
+	}
+}
+
+func TestRequireSecondFactorFailsClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useTestRelyingParty(t)
+
+	// The passkey store is not reachable, so it is unknown whether the user has a passkey
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/users/login", nil)
+
+	if !requireSecondFactor(context.Background(), c, testWebAuthnUser().User, "password", "", false) {
+		t.Fatal("login went ahead without checking for passkeys")
+	}
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRequireSecondFactorWithPasskeysDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := helpers.WebAuthn
+	helpers.WebAuthn = nil
+	t.Cleanup(func() { helpers.WebAuthn = previous })
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/users/login", nil)
+
+	if requireSecondFactor(context.Background(), c, testWebAuthnUser().User, "password", "", false) {
+		t.Fatal("second factor required while passkeys are disabled")
+	}
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var webhookCollection *mongo.Collection
+var webhookDeliveryCollection *mongo.Collection
+
+// webhookRequest is the body accepted by CreateWebhook and UpdateWebhook
+type webhookRequest struct {
+	Url         *string  `json:"url" validate:"omitempty,url,startswith=http"`
+	Events      []string `json:"events" validate:"omitempty,min=1"`
+	Description *string  `json:"description" validate:"omitempty,max=200"`
+	Active      *bool    `json:"active"`
+}
+
+// InitializeWebhookController initializes the package variables after DB connection
+func InitializeWebhookController() {
+	webhookCollection = database.GetCollection("webhooks")
+	webhookDeliveryCollection = database.GetCollection("webhook_deliveries")
+}
+
+// CreateWebhook registers an endpoint for user lifecycle events and returns its signing secret once (Admin only)
+func CreateWebhook() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request webhookRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+		if request.Url == nil || len(request.Events) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "url and events are required",
+			})
+			return
+		}
+		if err := helpers.ValidateWebhookEvents(request.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Generate the signing secret
+		secret, err := helpers.RandomString(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while generating the secret",
+			})
+			return
+		}
+
+		now := time.Now().UTC()
+		webhook := models.Webhook{
+			ID:         primitive.NewObjectID(),
+			Url:        *request.Url,
+			Events:     request.Events,
+			Secret:     "whsec_" + secret,
+			Active:     request.Active == nil || *request.Active,
+			Created_by: c.GetString("uid"),
+			Created_at: now,
+			Updated_at: now,
+		}
+		webhook.Webhook_id = webhook.ID.Hex()
+		if request.Description != nil {
+			webhook.Description = *request.Description
+		}
+
+		if _, err := webhookCollection.InsertOne(ctx, webhook); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Webhook was not created",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditWebhookCreate, TargetType: "webhook", TargetID: webhook.Webhook_id, Reason: webhook.Url})
+
+		// The secret is only ever returned here
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Webhook created successfully",
+			"secret":  webhook.Secret,
+			"webhook": webhook,
+		})
+	})
+}
+
+// GetWebhooks lists the registered webhooks (Admin only)
+func GetWebhooks() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := webhookCollection.Find(ctx, bson.M{}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing webhooks",
+			})
+			return
+		}
+
+		webhooks := []models.Webhook{}
+		if err := cursor.All(ctx, &webhooks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing webhooks",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"webhooks": webhooks,
+		})
+	})
+}
+
+// UpdateWebhook changes the URL, subscribed events, description or active flag of a webhook (Admin only)
+func UpdateWebhook() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		webhookId := c.Param("webhook_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request webhookRequest
+
+		if !bindRequest(c, &request) {
+			return
+		}
+		if err := helpers.ValidateWebhookEvents(request.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Create update document
+		update := bson.M{"updated_at": time.Now().UTC()}
+		if request.Url != nil {
+			update["url"] = *request.Url
+		}
+		if request.Events != nil {
+			update["events"] = request.Events
+		}
+		if request.Description != nil {
+			update["description"] = *request.Description
+		}
+		if request.Active != nil {
+			update["active"] = *request.Active
+		}
+
+		var webhook models.Webhook
+		err := webhookCollection.FindOneAndUpdate(ctx,
+			bson.M{"webhook_id": webhookId},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&webhook)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditWebhookUpdate, TargetType: "webhook", TargetID: webhookId})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook updated successfully",
+			"webhook": webhook,
+		})
+	})
+}
+
+// DeleteWebhook removes a webhook; its pending deliveries are dropped (Admin only)
+func DeleteWebhook() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		webhookId := c.Param("webhook_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := webhookCollection.DeleteOne(ctx, bson.M{"webhook_id": webhookId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while deleting the webhook",
+			})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not found",
+			})
+			return
+		}
+
+		helpers.Audit(c, helpers.AuditRecord{Action: helpers.AuditWebhookDelete, TargetType: "webhook", TargetID: webhookId})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook deleted successfully",
+		})
+	})
+}
+
+// GetWebhookDeliveries lists the delivery log of a webhook, newest first, optionally by status (Admin only)
+func GetWebhookDeliveries() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookDeliveryCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+		webhookId := c.Param("webhook_id")
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{"webhook_id": webhookId}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		// Get pagination parameters
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+		if err != nil || recordPerPage < 1 || recordPerPage > 100 {
+			recordPerPage = 20
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip(int64((page - 1) * recordPerPage)).
+			SetLimit(int64(recordPerPage))
+		cursor, err := webhookDeliveryCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing deliveries",
+			})
+			return
+		}
+
+		deliveries := []models.WebhookDelivery{}
+		if err := cursor.All(ctx, &deliveries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while listing deliveries",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"deliveries": deliveries,
+			"page":       page,
+			"per_page":   recordPerPage,
+		})
+	})
+}
+
+// RedeliverWebhook queues a delivery again for an immediate attempt (Admin only)
+func RedeliverWebhook() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// Ensure initialization
+		if webhookDeliveryCollection == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Database not initialized",
+			})
+			return
+		}
+
+		// Check if user is admin
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := webhookDeliveryCollection.UpdateOne(ctx,
+			bson.M{"delivery_id": c.Param("delivery_id"), "webhook_id": c.Param("webhook_id")},
+			bson.M{"$set": bson.M{
+				"status":          helpers.DeliveryPending,
+				"attempts":        0,
+				"next_attempt_at": time.Now().UTC(),
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Error occurred while queueing the delivery",
+			})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Delivery not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Delivery queued",
+		})
+	})
+}
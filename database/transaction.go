@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var transactionSupport struct {
+	once      sync.Once
+	supported bool
+}
+
+// SupportsTransactions reports whether the server is a replica set member or mongos,
+// the deployments on which MongoDB supports multi-document transactions
+func SupportsTransactions(ctx context.Context) bool {
+	transactionSupport.once.Do(func() {
+		var hello struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		err := DB.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err != nil {
+			log.Println("Failed to detect transaction support:", err)
+			return
+		}
+
+		transactionSupport.supported = hello.SetName != "" || hello.Msg == "isdbgrid"
+		if !transactionSupport.supported {
+			log.Println("MongoDB is a standalone server; writes that should be atomic run without a transaction")
+		}
+	})
+	return transactionSupport.supported
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors. The ctx passed
+// to fn must be used for every operation that belongs to the transaction. On a standalone
+// server, which cannot run transactions, fn runs once without one.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !SupportsTransactions(ctx) {
+		return fn(ctx)
+	}
+
+	session, err := DB.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
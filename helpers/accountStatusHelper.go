@@ -0,0 +1,119 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Account states. Users without a stored status are active.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusLocked    = "locked"
+	StatusPending   = "pending"
+)
+
+// Account status events
+const (
+	EventUserSuspended  = "user.suspended"
+	EventUserReinstated = "user.reinstated"
+)
+
+// AccountStatuses lists every account status
+var AccountStatuses = []string{StatusActive, StatusSuspended, StatusLocked, StatusPending}
+
+// SignupRequiresApproval makes new accounts pending until an admin reinstates them
+var SignupRequiresApproval bool
+
+// InitializeAccountStatusHelper initializes the package variables.
+// SIGNUP_REQUIRE_APPROVAL=true creates new accounts as pending.
+func InitializeAccountStatusHelper() {
+	SignupRequiresApproval = os.Getenv("SIGNUP_REQUIRE_APPROVAL") == "true"
+	if SignupRequiresApproval {
+		log.Println("New accounts stay pending until an admin activates them")
+	}
+}
+
+// NewAccountStatus returns the status new accounts are created with
+func NewAccountStatus() string {
+	if SignupRequiresApproval {
+		return StatusPending
+	}
+	return StatusActive
+}
+
+// EffectiveAccountStatus returns the status in force: a status whose expiry has passed,
+// like no status at all, means the account is active
+func EffectiveAccountStatus(status string, until *time.Time) string {
+	if status == "" || (until != nil && !until.After(time.Now())) {
+		return StatusActive
+	}
+	return status
+}
+
+// UserAccountStatus returns the status in force for a user
+func UserAccountStatus(user models.User) string {
+	var status string
+	if user.Status != nil {
+		status = *user.Status
+	}
+	return EffectiveAccountStatus(status, user.Status_until)
+}
+
+// AccountStatusMessage explains to the account owner why they cannot sign in
+func AccountStatusMessage(status string) string {
+	switch status {
+	case StatusSuspended:
+		return "This account has been suspended"
+	case StatusLocked:
+		return "This account is locked"
+	case StatusPending:
+		return "This account is pending activation"
+	default:
+		return "This account is not active"
+	}
+}
+
+// SetAccountStatus changes the status of a user who is not deleted and reports whether
+// the user was found. Leaving active ends the user's session. Call InvalidateUserState
+// once the change is committed.
+func SetAccountStatus(ctx context.Context, userId string, status string, reason string, until *time.Time, changedBy string) (bool, error) {
+	now := time.Now().UTC()
+	set := bson.M{
+		"status":            status,
+		"status_changed_at": now,
+		"status_changed_by": changedBy,
+		"updated_at":        now,
+	}
+	unset := bson.M{}
+	if reason != "" {
+		set["status_reason"] = reason
+	} else {
+		unset["status_reason"] = ""
+	}
+	if until != nil {
+		set["status_until"] = until.UTC()
+	} else {
+		unset["status_until"] = ""
+	}
+	if status != StatusActive {
+		set["token"] = nil
+		set["refresh_token"] = nil
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := userCollection.UpdateOne(ctx, NotDeleted(bson.M{"user_id": userId}), update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
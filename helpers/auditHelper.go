@@ -0,0 +1,293 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outcomes of an audited action
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// Audited actions
+const (
+	AuditSignup           = "auth.signup"
+	AuditLogin            = "auth.login"
+	AuditReauthenticate   = "auth.reauthenticate"
+	AuditRefresh          = "auth.refresh"
+	AuditLogout           = "auth.logout"
+	AuditMagicLinkRequest = "auth.magic_link.request"
+	AuditUserUpdate       = "user.update"
+	AuditUserDelete       = "user.delete"
+	AuditUserRestore      = "user.restore"
+	AuditUserPurge        = "user.purge"
+	AuditUserExport       = "user.export"
+	AuditUserErase        = "user.erase"
+	AuditUserSuspend      = "user.suspend"
+	AuditUserReinstate    = "user.reinstate"
+	AuditUserImport       = "user.import"
+	AuditUserBulkExport   = "user.bulk_export"
+	AuditTokenCreate      = "token.create"
+	AuditTokenRevoke      = "token.revoke"
+	AuditImpersonate      = "user.impersonate"
+	AuditIdentityLink     = "user.identity_link"
+	AuditPasskeyRegister  = "passkey.register"
+	AuditPasskeyDelete    = "passkey.delete"
+	AuditLogVerify        = "audit.verify"
+	AuditWebhookCreate    = "webhook.create"
+	AuditWebhookUpdate    = "webhook.update"
+	AuditWebhookDelete    = "webhook.delete"
+)
+
+// Actor recorded for actions taken by the service itself
+const AuditSystemActor = "system"
+
+// The first entry links to an empty hash
+const auditGenesisHash = ""
+
+// How often an append is retried when another writer took the next sequence
+const auditMaxAppendAttempts = 20
+
+// Encoding of the fields covered by the chain hash. Versions start at 1, so an entry that
+// lost its version never verifies.
+const auditHashJSON = 1
+
+// AuditRecord describes an audited action. The actor, IP address and user agent are
+// taken from the request when not set.
+type AuditRecord struct {
+	Action     string
+	Outcome    string
+	ActorID    string
+	ActorEmail string
+	TargetType string
+	TargetID   string
+	Reason     string
+	Changes    map[string]string
+}
+
+var auditCollection *mongo.Collection
+
+// InitializeAuditHelper initializes the package variables after DB connection
+func InitializeAuditHelper() {
+	auditCollection = database.GetCollection("audit_log")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Two entries can never claim the same place in the chain
+	_, err := auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sequence", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		log.Println("Failed to create audit log indexes:", err)
+	}
+}
+
+// Audit appends an entry for the request to the audit log. Failures are logged and
+// never change the response of the audited request.
+func Audit(c *gin.Context, record AuditRecord) {
+	event := models.AuditEvent{
+		Action:          record.Action,
+		Outcome:         record.Outcome,
+		Actor_id:        record.ActorID,
+		Actor_email:     record.ActorEmail,
+		Impersonator_id: c.GetString("actor_uid"),
+		Target_type:     record.TargetType,
+		Target_id:       record.TargetID,
+		Reason:          record.Reason,
+		Changes:         record.Changes,
+		Ip_address:      c.ClientIP(),
+		User_agent:      c.Request.UserAgent(),
+	}
+	if event.Actor_id == "" {
+		event.Actor_id = c.GetString("uid")
+	}
+	if event.Actor_email == "" {
+		event.Actor_email = c.GetString("email")
+	}
+	if event.Outcome == "" {
+		event.Outcome = AuditSuccess
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := AppendAuditEvent(ctx, &event); err != nil {
+		log.Println("Failed to write audit event "+event.Action+":", err)
+	}
+}
+
+// AuditSystem appends an entry for an action taken by the service itself, such as a
+// background job, rather than on behalf of a request
+func AuditSystem(ctx context.Context, record AuditRecord) {
+	event := models.AuditEvent{
+		Action:      record.Action,
+		Outcome:     record.Outcome,
+		Actor_id:    record.ActorID,
+		Actor_email: record.ActorEmail,
+		Target_type: record.TargetType,
+		Target_id:   record.TargetID,
+		Reason:      record.Reason,
+		Changes:     record.Changes,
+	}
+	if event.Actor_id == "" {
+		event.Actor_id = AuditSystemActor
+	}
+	if event.Outcome == "" {
+		event.Outcome = AuditSuccess
+	}
+
+	if err := AppendAuditEvent(ctx, &event); err != nil {
+		log.Println("Failed to write audit event "+event.Action+":", err)
+	}
+}
+
+// AppendAuditEvent links an event to the end of the chain and stores it. Concurrent
+// writers race for the next sequence; the unique index on it lets one win and the
+// others link to the winner's entry and try again.
+func AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	// Ensure initialization
+	if auditCollection == nil {
+		return errors.New("audit log not initialized")
+	}
+
+	// MongoDB keeps millisecond precision, so hash what will be read back
+	event.Created_at = time.Now().UTC().Truncate(time.Millisecond)
+	event.Pii_digest = AuditPiiDigest(event)
+	event.Hash_version = auditHashJSON
+
+	for attempt := 0; attempt < auditMaxAppendAttempts; attempt++ {
+		var last models.AuditEvent
+		err := auditCollection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})).Decode(&last)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			event.Sequence = 1
+			event.Prev_hash = auditGenesisHash
+		case err != nil:
+			return err
+		default:
+			event.Sequence = last.Sequence + 1
+			event.Prev_hash = last.Hash
+		}
+
+		event.ID = primitive.NewObjectID()
+		event.Event_id = event.ID.Hex()
+		event.Hash = AuditEventHash(event)
+
+		_, err = auditCollection.InsertOne(ctx, event)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		// Another writer appended first; wait a little so the writers spread out, then
+		// link to the new end of the chain
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(rand.Int64N(int64(attempt+1) * int64(time.Millisecond)))):
+		}
+	}
+	return errors.New("audit log is too busy")
+}
+
+// AuditPiiDigest returns the digest standing in for the event's personal data in its hash,
+// so personal data can later be redacted without breaking the chain
+func AuditPiiDigest(event *models.AuditEvent) string {
+	pii, _ := json.Marshal(struct {
+		ActorEmail string            `json:"actor_email"`
+		IpAddress  string            `json:"ip_address"`
+		UserAgent  string            `json:"user_agent"`
+		Changes    map[string]string `json:"changes"`
+	}{event.Actor_email, event.Ip_address, event.User_agent, event.Changes})
+
+	sum := sha256.Sum256(pii)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditEventHash returns the chain hash of an event over a JSON encoding of its fields.
+// Entries of another Hash_version get no hash, so they never verify.
+func AuditEventHash(event *models.AuditEvent) string {
+	if event.Hash_version != auditHashJSON {
+		return ""
+	}
+
+	encoded, _ := json.Marshal(struct {
+		PrevHash       string `json:"prev_hash"`
+		Sequence       int64  `json:"sequence"`
+		CreatedAt      string `json:"created_at"`
+		Action         string `json:"action"`
+		Outcome        string `json:"outcome"`
+		ActorID        string `json:"actor_id"`
+		ImpersonatorID string `json:"impersonator_id"`
+		TargetType     string `json:"target_type"`
+		TargetID       string `json:"target_id"`
+		Reason         string `json:"reason"`
+		PiiDigest      string `json:"pii_digest"`
+	}{
+		event.Prev_hash,
+		event.Sequence,
+		event.Created_at.UTC().Format(time.RFC3339Nano),
+		event.Action,
+		event.Outcome,
+		event.Actor_id,
+		event.Impersonator_id,
+		event.Target_type,
+		event.Target_id,
+		event.Reason,
+		event.Pii_digest,
+	})
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain walks the whole audit log in order and checks every link. It returns
+// the number of entries checked and, when the chain is broken, the first bad sequence.
+func VerifyAuditChain(ctx context.Context) (checked int64, brokenAt int64, err error) {
+	// Ensure initialization
+	if auditCollection == nil {
+		return 0, 0, errors.New("audit log not initialized")
+	}
+
+	cursor, err := auditCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	prevHash := auditGenesisHash
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return checked, 0, err
+		}
+		checked++
+
+		if event.Sequence != checked || event.Prev_hash != prevHash ||
+			(!event.Redacted && event.Pii_digest != AuditPiiDigest(&event)) || event.Hash != AuditEventHash(&event) {
+			return checked, checked, nil
+		}
+		prevHash = event.Hash
+	}
+	return checked, 0, cursor.Err()
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAuditEventHashSeparatesFields(t *testing.T) {
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	shifted := func(version int, targetId string, reason string) *models.AuditEvent {
+		return &models.AuditEvent{Sequence: 1, Created_at: createdAt, Action: AuditLogin, Target_id: targetId, Reason: reason, Hash_version: version}
+	}
+
+	// A newline moved from one field into the next must change the hash
+	if AuditEventHash(shifted(auditHashJSON, "a\nb", "c")) == AuditEventHash(shifted(auditHashJSON, "a", "b\nc")) {
+		t.Fatal("hash does not tell the fields apart")
+	}
+	for _, version := range []int{0, auditHashJSON + 1} {
+		if hash := AuditEventHash(shifted(version, "a", "b")); hash != "" {
+			t.Fatalf("hash of version %d = %q, want none", version, hash)
+		}
+	}
+}
+
+func TestAppendAuditEventRetriesTakenSequence(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("another writer appended first", func(mt *mtest.T) {
+		auditCollection = mt.Coll
+		defer func() { auditCollection = nil }()
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{{Key: "sequence", Value: int64(1)}, {Key: "hash", Value: "first"}}),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{{Key: "sequence", Value: int64(2)}, {Key: "hash", Value: "second"}}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		event := &models.AuditEvent{Action: AuditLogin, Outcome: AuditSuccess}
+		if err := AppendAuditEvent(context.Background(), event); err != nil {
+			mt.Fatalf("AppendAuditEvent: %v", err)
+		}
+		if event.Sequence != 3 || event.Prev_hash != "second" {
+			mt.Fatalf("appended as sequence %d after %q, want 3 after %q", event.Sequence, event.Prev_hash, "second")
+		}
+		if event.Hash_version != auditHashJSON || event.Hash != AuditEventHash(event) {
+			mt.Fatal("appended entry is not hashed with the JSON encoding")
+		}
+	})
+}
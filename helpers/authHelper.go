@@ -2,10 +2,27 @@ package helpers
 
 import (
 	"errors"
+	"log"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// StepUpMaxAge is how long ago the user may have authenticated for sensitive operations
+var StepUpMaxAge = 5 * time.Minute
+
+// InitializeAuthHelper loads authorization settings from the environment
+func InitializeAuthHelper() {
+	if raw := os.Getenv("STEP_UP_MAX_AGE"); raw != "" {
+		maxAge, err := time.ParseDuration(raw)
+		if err != nil || maxAge <= 0 {
+			log.Fatal("STEP_UP_MAX_AGE must be a positive duration such as 5m")
+		}
+		StepUpMaxAge = maxAge
+	}
+}
+
 // CheckUserType checks if the user has the required user type
 func CheckUserType(c *gin.Context, role string) (err error) {
 	userType := c.GetString("user_type")
@@ -38,3 +55,28 @@ func MatchUserTypeToUid(c *gin.Context, userId string) (err error) {
 	err = errors.New("unauthorized to access this resource")
 	return err
 }
+
+// CheckNotImpersonated rejects requests made with an impersonation token
+func CheckNotImpersonated(c *gin.Context) (err error) {
+	err = nil
+
+	if c.GetBool("impersonated") {
+		err = errors.New("this operation is not allowed while impersonating a user")
+		return err
+	}
+
+	return err
+}
+
+// CheckRecentAuth checks that the user authenticated no longer than maxAge ago
+func CheckRecentAuth(c *gin.Context, maxAge time.Duration) (err error) {
+	err = nil
+
+	authTime := c.GetTime("auth_time")
+	if authTime.IsZero() || time.Since(authTime) > maxAge {
+		err = errors.New("this operation requires recent authentication, please re-authenticate")
+		return err
+	}
+
+	return err
+}
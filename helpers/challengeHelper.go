@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of RFC 6750 section 3.1, RFC 9449 and RFC 9470
+const (
+	ErrInvalidRequest                 = "invalid_request"
+	ErrInvalidToken                   = "invalid_token"
+	ErrInsufficientScope              = "insufficient_scope"
+	ErrInvalidDPoPProof               = "invalid_dpop_proof"
+	ErrInsufficientUserAuthentication = "insufficient_user_authentication"
+)
+
+// AbortWithChallenge ends the request with a WWW-Authenticate challenge for scheme and a
+// matching JSON body. An empty code produces a bare challenge, as required when the
+// request carried no credentials at all. extra holds additional name/value pairs.
+func AbortWithChallenge(c *gin.Context, status int, scheme string, code string, description string, extra ...any) {
+	params := []string{}
+	body := gin.H{}
+
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code), fmt.Sprintf("error_description=%q", description))
+		body["error"] = code
+		body["error_description"] = description
+	} else {
+		body["error"] = description
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		name := fmt.Sprint(extra[i])
+		switch value := extra[i+1].(type) {
+		case string:
+			params = append(params, fmt.Sprintf("%s=%q", name, value))
+		default:
+			params = append(params, fmt.Sprintf("%s=%v", name, value))
+		}
+		body[name] = extra[i+1]
+	}
+
+	challenge := scheme
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.JSON(status, body)
+	c.Abort()
+}
+
+// AbortInsufficientAuthentication sends an RFC 9470 step-up challenge
+func AbortInsufficientAuthentication(c *gin.Context, maxAge time.Duration, description string) {
+	AbortWithChallenge(c, http.StatusUnauthorized, ChallengeScheme(c), ErrInsufficientUserAuthentication, description, "max_age", int(maxAge.Seconds()))
+}
+
+// ChallengeScheme returns the authentication scheme to challenge with for this request
+func ChallengeScheme(c *gin.Context) string {
+	if c.GetString("dpop_jkt") != "" || strings.HasPrefix(strings.ToLower(c.GetHeader("Authorization")), "dpop ") {
+		return "DPoP"
+	}
+	return "Bearer"
+}
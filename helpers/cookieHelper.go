@@ -0,0 +1,97 @@
+package helpers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie and header names used by browser session mode
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// CookieSessions is true when tokens are handed to browsers as cookies instead of in response bodies
+var CookieSessions bool
+var cookieSecure = true
+var cookieSameSite = http.SameSiteLaxMode
+var cookieDomain string
+
+// InitializeCookieHelper loads the browser session settings from the environment.
+// COOKIE_SESSIONS=true enables the mode; COOKIE_SECURE=false allows plain HTTP for
+// local development; COOKIE_SAMESITE is one of strict, lax (default) or none;
+// COOKIE_DOMAIN optionally scopes the cookies to a parent domain.
+func InitializeCookieHelper() {
+	CookieSessions = os.Getenv("COOKIE_SESSIONS") == "true"
+	cookieSecure = os.Getenv("COOKIE_SECURE") != "false"
+	cookieDomain = os.Getenv("COOKIE_DOMAIN")
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "lax":
+		cookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		cookieSameSite = http.SameSiteStrictMode
+	case "none":
+		cookieSameSite = http.SameSiteNoneMode
+		if !cookieSecure {
+			log.Fatal("COOKIE_SAMESITE=none requires secure cookies")
+		}
+	default:
+		log.Fatal("COOKIE_SAMESITE must be strict, lax or none")
+	}
+}
+
+// SetSessionCookies stores the tokens in HttpOnly cookies and issues a new CSRF token
+// that the frontend must echo in the X-CSRF-Token header
+func SetSessionCookies(c *gin.Context, accessToken string, refreshToken string) error {
+	csrfToken, err := RandomString(32)
+	if err != nil {
+		return err
+	}
+
+	setCookie(c, AccessTokenCookie, accessToken, "/", int(AccessTokenTTL.Seconds()), true)
+	if refreshToken != "" {
+		setCookie(c, RefreshTokenCookie, refreshToken, "/auth", int(RefreshTokenTTL.Seconds()), true)
+	}
+
+	// Readable by the frontend script so it can be sent back as a header
+	setCookie(c, CSRFCookie, csrfToken, "/", int(RefreshTokenTTL.Seconds()), false)
+	return nil
+}
+
+// ClearSessionCookies removes all browser session cookies
+func ClearSessionCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", "/", -1, true)
+	setCookie(c, RefreshTokenCookie, "", "/auth", -1, true)
+	setCookie(c, CSRFCookie, "", "/", -1, false)
+}
+
+// CheckCSRFToken checks the double-submitted CSRF token of a cookie-authenticated request
+func CheckCSRFToken(c *gin.Context) bool {
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	if err != nil || cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+func setCookie(c *gin.Context, name string, value string, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cookieDomain,
+		MaxAge:   maxAge,
+		Secure:   cookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite,
+	})
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetSessionCookies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	if err := SetSessionCookies(c, "access", "refresh"); err != nil {
+		t.Fatalf("SetSessionCookies: %v", err)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	// Scripts must not read the tokens, but must read the CSRF token to echo it
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if cookie := cookies[name]; cookie == nil || !cookie.HttpOnly || !cookie.Secure {
+			t.Fatalf("%s cookie = %+v, want a secure HttpOnly cookie", name, cookie)
+		}
+	}
+	if cookies[RefreshTokenCookie].Path != "/auth" {
+		t.Fatalf("refresh cookie path = %q, want /auth", cookies[RefreshTokenCookie].Path)
+	}
+	csrf := cookies[CSRFCookie]
+	if csrf == nil || csrf.HttpOnly || csrf.Value == "" {
+		t.Fatalf("CSRF cookie = %+v, want a readable random token", csrf)
+	}
+
+	// Every session gets a CSRF token of its own
+	again := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(again)
+	SetSessionCookies(c, "access", "refresh")
+	for _, cookie := range again.Result().Cookies() {
+		if cookie.Name == CSRFCookie && cookie.Value == csrf.Value {
+			t.Fatal("CSRF token was reused")
+		}
+	}
+}
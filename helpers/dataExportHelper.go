@@ -0,0 +1,458 @@
+package helpers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Formats a data export can be downloaded in
+const (
+	DataExportJSON = "json"
+	DataExportZIP  = "zip"
+)
+
+// Export states
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// How long the worker owns an export it is building before another worker may take it over
+const dataExportLease = 5 * time.Minute
+
+// Exports that failed this often are given up
+const dataExportMaxAttempts = 3
+
+const dataExportPollInterval = 5 * time.Second
+
+var dataExportCollection *mongo.Collection
+var dataExportBucket *gridfs.Bucket
+var magicLinkRecordCollection *mongo.Collection
+var impersonationRecordCollection *mongo.Collection
+var dataExportTTL = 24 * time.Hour
+
+// DataExportSyncLimit is the number of records above which an export is built in the background
+var DataExportSyncLimit int64 = 1000
+
+// UserDataBundle is everything stored about a user, as handed to them on request
+type UserDataBundle struct {
+	Generated_at           time.Time                    `json:"generated_at"`
+	Profile                models.UserRecord            `json:"profile"`
+	Login_history          []models.LoginEvent          `json:"login_history"`
+	Sessions               UserSessions                 `json:"sessions"`
+	Personal_access_tokens []models.PersonalAccessToken `json:"personal_access_tokens"`
+	Passkeys               []models.WebAuthnCredential  `json:"passkeys"`
+	Magic_links            []models.MagicLink           `json:"magic_links"`
+	Audit_events           []models.AuditEvent          `json:"audit_events"`
+}
+
+// UserSessions describes the sign-in sessions of a user
+type UserSessions struct {
+	Active         bool                          `json:"active"`
+	Impersonations []models.ImpersonationSession `json:"impersonations"`
+}
+
+// InitializeDataExportHelper initializes the package variables after DB connection.
+// DATA_EXPORT_TTL (default 24h) is how long a finished export can be downloaded and
+// DATA_EXPORT_SYNC_LIMIT (default 1000) the number of records up to which an export is
+// returned directly instead of being built in the background.
+func InitializeDataExportHelper() {
+	dataExportCollection = database.GetCollection("data_exports")
+	magicLinkRecordCollection = database.GetCollection("magic_links")
+	impersonationRecordCollection = database.GetCollection("impersonation_sessions")
+
+	bucket, err := gridfs.NewBucket(database.DB.DB, options.GridFSBucket().SetName("data_exports"))
+	if err != nil {
+		log.Fatal("Failed to open data export bucket: ", err)
+	}
+	dataExportBucket = bucket
+
+	if raw := os.Getenv("DATA_EXPORT_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			log.Fatal("DATA_EXPORT_TTL must be a positive duration such as 24h")
+		}
+		dataExportTTL = ttl
+	}
+	if raw := os.Getenv("DATA_EXPORT_SYNC_LIMIT"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 0 {
+			log.Fatal("DATA_EXPORT_SYNC_LIMIT must be a number of records")
+		}
+		DataExportSyncLimit = limit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Exports are listed per user, claimed by the worker and removed once expired
+	_, err = dataExportCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "claimed_until", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	})
+	if err != nil {
+		log.Println("Failed to create data export indexes:", err)
+	}
+}
+
+// ValidDataExportFormat reports whether format is a supported export format
+func ValidDataExportFormat(format string) bool {
+	return format == DataExportJSON || format == DataExportZIP
+}
+
+// DataExportContentType returns the media type of an export in format
+func DataExportContentType(format string) string {
+	if format == DataExportZIP {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+// DataExportFilename returns the download name of an export of userId in format
+func DataExportFilename(userId string, format string) string {
+	return "user-" + userId + "-export." + format
+}
+
+// CountUserRecords returns how many records an export of the user would contain
+func CountUserRecords(ctx context.Context, userId string) (int64, error) {
+	counts := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{loginEventCollection, bson.M{"user_id": userId}},
+		{patCollection, bson.M{"user_id": userId}},
+		{webAuthnCredentialCollection, bson.M{"user_id": userId}},
+		{magicLinkRecordCollection, bson.M{"user_id": userId}},
+		{impersonationRecordCollection, bson.M{"target_id": userId}},
+		{auditCollection, userAuditFilter(userId)},
+	}
+
+	var total int64
+	for _, count := range counts {
+		n, err := count.collection.CountDocuments(ctx, count.filter)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// CollectUserData assembles everything stored about a user. Secrets are left out, as
+// is personal data of others, such as the admins who acted on the account.
+func CollectUserData(ctx context.Context, userId string) (*UserDataBundle, error) {
+	bundle := &UserDataBundle{Generated_at: time.Now().UTC()}
+
+	// The refresh token is only loaded to tell whether a session is active
+	projection := maps.Clone(UserRecordProjection)
+	projection["refresh_token"] = 1
+	var user models.User
+	if err := userCollection.FindOne(ctx, NotDeleted(bson.M{"user_id": userId}), options.FindOne().SetProjection(projection)).Decode(&user); err != nil {
+		return nil, err
+	}
+	bundle.Profile = NewUserRecord(user)
+	bundle.Sessions.Active = user.Refresh_token != nil
+
+	newestFirst := bson.D{{Key: "created_at", Value: -1}}
+	var err error
+	if bundle.Login_history, err = findAll[models.LoginEvent](ctx, loginEventCollection, bson.M{"user_id": userId}, newestFirst); err != nil {
+		return nil, err
+	}
+	if bundle.Personal_access_tokens, err = findAll[models.PersonalAccessToken](ctx, patCollection, bson.M{"user_id": userId}, newestFirst); err != nil {
+		return nil, err
+	}
+	if bundle.Passkeys, err = findAll[models.WebAuthnCredential](ctx, webAuthnCredentialCollection, bson.M{"user_id": userId}, newestFirst); err != nil {
+		return nil, err
+	}
+	if bundle.Magic_links, err = findAll[models.MagicLink](ctx, magicLinkRecordCollection, bson.M{"user_id": userId}, newestFirst); err != nil {
+		return nil, err
+	}
+	if bundle.Sessions.Impersonations, err = findAll[models.ImpersonationSession](ctx, impersonationRecordCollection, bson.M{"target_id": userId}, newestFirst); err != nil {
+		return nil, err
+	}
+	if bundle.Audit_events, err = findAll[models.AuditEvent](ctx, auditCollection, userAuditFilter(userId), bson.D{{Key: "sequence", Value: 1}}); err != nil {
+		return nil, err
+	}
+
+	for i := range bundle.Sessions.Impersonations {
+		session := &bundle.Sessions.Impersonations[i]
+		session.Admin_email, session.Ip_address, session.User_agent = "", "", ""
+	}
+	for i := range bundle.Audit_events {
+		if event := &bundle.Audit_events[i]; event.Actor_id != userId {
+			event.Actor_email, event.Ip_address, event.User_agent = "", "", ""
+		}
+	}
+
+	return bundle, nil
+}
+
+// WriteUserDataBundle writes the bundle as one JSON document or as a ZIP archive with
+// one JSON file per section
+func WriteUserDataBundle(w io.Writer, bundle *UserDataBundle, format string) error {
+	if format == DataExportJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bundle)
+	}
+
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile", bundle.Profile},
+		{"login_history", bundle.Login_history},
+		{"sessions", bundle.Sessions},
+		{"personal_access_tokens", bundle.Personal_access_tokens},
+		{"passkeys", bundle.Passkeys},
+		{"magic_links", bundle.Magic_links},
+		{"audit_events", bundle.Audit_events},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, section := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     section.name + ".json",
+			Method:   zip.Deflate,
+			Modified: bundle.Generated_at,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// CreateDataExport queues an export of a user's data to be built in the background
+func CreateDataExport(ctx context.Context, userId string, requestedBy string, format string) (*models.DataExport, error) {
+	now := time.Now().UTC()
+	export := models.DataExport{
+		ID:           primitive.NewObjectID(),
+		User_id:      userId,
+		Requested_by: requestedBy,
+		Format:       format,
+		Status:       DataExportPending,
+		Created_at:   now,
+		Expires_at:   now.Add(dataExportTTL),
+	}
+	export.Export_id = export.ID.Hex()
+
+	if _, err := dataExportCollection.InsertOne(ctx, export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// FindDataExport loads an export of the user's data
+func FindDataExport(ctx context.Context, userId string, exportId string) (*models.DataExport, error) {
+	var export models.DataExport
+	err := dataExportCollection.FindOne(ctx, bson.M{"export_id": exportId, "user_id": userId}).Decode(&export)
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// OpenDataExport opens the stored bundle of a finished export
+func OpenDataExport(export *models.DataExport) (*gridfs.DownloadStream, error) {
+	if export.Status != DataExportReady || export.File_id == nil {
+		return nil, errors.New("the export is not ready")
+	}
+	return dataExportBucket.OpenDownloadStream(*export.File_id)
+}
+
+// StartDataExportWorker builds queued exports and removes expired ones in the background until ctx is done
+func StartDataExportWorker(ctx context.Context) {
+	// Ensure initialization
+	if dataExportCollection == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(dataExportPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for buildNextDataExport(ctx) {
+			}
+			removeExpiredDataExports(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// buildNextDataExport claims one queued export and builds it. It reports whether an export was found.
+func buildNextDataExport(ctx context.Context) bool {
+	now := time.Now().UTC()
+
+	var export models.DataExport
+	err := dataExportCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"status": bson.M{"$in": []string{DataExportPending, DataExportRunning}},
+			"$or": []bson.M{
+				{"claimed_until": nil},
+				{"claimed_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"status": DataExportRunning, "claimed_until": now.Add(dataExportLease)},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&export)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Println("Failed to claim data export:", err)
+		}
+		return false
+	}
+
+	fileId, size, err := storeDataExport(ctx, &export)
+
+	update := bson.M{"claimed_until": nil}
+	switch {
+	case err == nil:
+		completedAt := time.Now().UTC()
+		update["status"] = DataExportReady
+		update["file_id"] = fileId
+		update["size"] = size
+		update["last_error"] = ""
+		update["completed_at"] = completedAt
+		update["expires_at"] = completedAt.Add(dataExportTTL)
+	case export.Attempts >= dataExportMaxAttempts:
+		update["status"] = DataExportFailed
+		update["last_error"] = err.Error()
+	default:
+		update["status"] = DataExportPending
+		update["claimed_until"] = time.Now().UTC().Add(time.Minute)
+		update["last_error"] = err.Error()
+	}
+
+	if _, err := dataExportCollection.UpdateOne(ctx, bson.M{"_id": export.ID}, bson.M{"$set": update}); err != nil {
+		log.Println("Failed to update data export:", err)
+	}
+	return true
+}
+
+// storeDataExport builds the bundle of an export and streams it into GridFS
+func storeDataExport(ctx context.Context, export *models.DataExport) (primitive.ObjectID, int64, error) {
+	bundle, err := CollectUserData(ctx, export.User_id)
+	if err != nil {
+		return primitive.NilObjectID, 0, fmt.Errorf("collecting user data: %w", err)
+	}
+
+	upload, err := dataExportBucket.OpenUploadStream(
+		DataExportFilename(export.User_id, export.Format),
+		options.GridFSUpload().SetMetadata(bson.M{"export_id": export.Export_id, "user_id": export.User_id}),
+	)
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+
+	counter := &countingWriter{w: upload}
+	if err := WriteUserDataBundle(counter, bundle, export.Format); err != nil {
+		upload.Abort()
+		return primitive.NilObjectID, 0, err
+	}
+	if err := upload.Close(); err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+	return upload.FileID.(primitive.ObjectID), counter.n, nil
+}
+
+// removeExpiredDataExports deletes expired exports together with their stored bundles
+func removeExpiredDataExports(ctx context.Context) {
+	if _, err := deleteDataExports(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now().UTC()}}); err != nil && ctx.Err() == nil {
+		log.Println("Failed to remove expired data exports:", err)
+	}
+}
+
+// deleteDataExports deletes the matching exports together with their stored bundles
+// and returns how many were deleted
+func deleteDataExports(ctx context.Context, filter bson.M) (int64, error) {
+	cursor, err := dataExportCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var exports []models.DataExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, export := range exports {
+		if export.File_id != nil {
+			err := dataExportBucket.DeleteContext(ctx, *export.File_id)
+			if err != nil && err != gridfs.ErrFileNotFound {
+				return deleted, err
+			}
+		}
+		if _, err := dataExportCollection.DeleteOne(ctx, bson.M{"_id": export.ID}); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// userAuditFilter matches the audit entries about a user or made by them
+func userAuditFilter(userId string) bson.M {
+	return bson.M{"$or": []bson.M{{"actor_id": userId}, {"target_id": userId}}}
+}
+
+// findAll decodes every document matching filter in the given order
+func findAll[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, sort bson.D) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []T{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
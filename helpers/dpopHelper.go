@@ -0,0 +1,204 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// How far a DPoP proof's iat may lie in the past or the future
+const dpopProofMaxAge = 5 * time.Minute
+const dpopClockSkew = 1 * time.Minute
+
+// Asymmetric algorithms accepted for DPoP proofs (RFC 9449 section 4.2)
+var dpopAlgorithms = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+// dpopClaims are the claims of a DPoP proof JWT
+type dpopClaims struct {
+	Htm string `json:"htm"`
+	Htu string `json:"htu"`
+	Ath string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// How often the replay cache drops the jti of proofs too old to be accepted anyway
+const dpopReplaySweepInterval = time.Minute
+
+// dpopReplayCache remembers the jti of accepted proofs until they are too old to be accepted again
+var dpopReplayCache = struct {
+	sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}{seen: map[string]time.Time{}}
+
+// dpopTrustedProxies are the networks whose X-Forwarded-Proto header is believed
+var dpopTrustedProxies []*net.IPNet
+
+// InitializeDPoPHelper reads TRUSTED_PROXIES, a comma separated list of the IP addresses
+// or CIDR ranges of the reverse proxies in front of the service. Only requests from them
+// may tell through X-Forwarded-Proto which scheme the client used.
+func InitializeDPoPHelper() {
+	dpopTrustedProxies = nil
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("TRUSTED_PROXIES entry %q is not an IP address or CIDR range", entry)
+		}
+		dpopTrustedProxies = append(dpopTrustedProxies, network)
+	}
+}
+
+// ValidateDPoPProof verifies a DPoP proof for the given request and returns the
+// base64url SHA-256 JWK thumbprint of its key. When accessToken is not empty the
+// proof must also carry its hash in the ath claim.
+func ValidateDPoPProof(proof string, method string, requestURL string, accessToken string) (jkt string, err error) {
+	var key jose.JSONWebKey
+
+	claims := &dpopClaims{}
+	_, err = jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != "dpop+jwt" {
+			return nil, errors.New("DPoP proof has the wrong typ")
+		}
+
+		// The public key travels in the proof header
+		rawKey, err := json.Marshal(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if err := key.UnmarshalJSON(rawKey); err != nil {
+			return nil, errors.New("DPoP proof has no valid jwk header")
+		}
+		if !key.IsPublic() {
+			return nil, errors.New("DPoP proof jwk must be a public key")
+		}
+		return key.Key, nil
+	}, jwt.WithValidMethods(dpopAlgorithms), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return "", errors.New("DPoP proof is invalid: " + err.Error())
+	}
+
+	// Bind the proof to this request
+	if claims.Htm != method {
+		return "", errors.New("DPoP proof htm does not match the request method")
+	}
+	if claims.Htu != requestURL {
+		return "", errors.New("DPoP proof htu does not match the request URL")
+	}
+
+	if claims.IssuedAt == nil {
+		return "", errors.New("DPoP proof has no iat")
+	}
+	issuedAt := claims.IssuedAt.Time
+	if time.Since(issuedAt) > dpopProofMaxAge || time.Until(issuedAt) > dpopClockSkew {
+		return "", errors.New("DPoP proof iat is outside the accepted window")
+	}
+
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if claims.Ath != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return "", errors.New("DPoP proof ath does not match the access token")
+		}
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", errors.New("DPoP proof jwk is invalid")
+	}
+
+	// Each proof may only be used once
+	if claims.ID == "" {
+		return "", errors.New("DPoP proof has no jti")
+	}
+	if !rememberDPoPProof(claims.ID, issuedAt) {
+		return "", errors.New("DPoP proof has already been used")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// rememberDPoPProof records a jti and reports whether it was unseen
+func rememberDPoPProof(jti string, issuedAt time.Time) bool {
+	dpopReplayCache.Lock()
+	defer dpopReplayCache.Unlock()
+
+	// Expired entries are ignored when looked up and only swept out now and then
+	now := time.Now()
+	if now.After(dpopReplayCache.nextSweep) {
+		for seenJti, expiresAt := range dpopReplayCache.seen {
+			if now.After(expiresAt) {
+				delete(dpopReplayCache.seen, seenJti)
+			}
+		}
+		dpopReplayCache.nextSweep = now.Add(dpopReplaySweepInterval)
+	}
+
+	if expiresAt, replayed := dpopReplayCache.seen[jti]; replayed && !now.After(expiresAt) {
+		return false
+	}
+	dpopReplayCache.seen[jti] = issuedAt.Add(dpopProofMaxAge + dpopClockSkew)
+	return true
+}
+
+// RequestURL returns the URL the client used for the request without query and fragment,
+// as required for the htu claim. PUBLIC_BASE_URL overrides scheme and host behind proxies;
+// otherwise X-Forwarded-Proto is honoured from the proxies in TRUSTED_PROXIES.
+func RequestURL(r *http.Request) string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/") + r.URL.Path
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if fromTrustedProxy(r) {
+		// Proxies in a chain each add the scheme they saw; the first is the client's
+		forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if forwarded = strings.ToLower(strings.TrimSpace(forwarded)); forwarded == "http" || forwarded == "https" {
+			scheme = forwarded
+		}
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// fromTrustedProxy reports whether a request came straight from a trusted proxy
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range dpopTrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
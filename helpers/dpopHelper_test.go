@@ -0,0 +1,213 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const dpopTestURL = "https://api.example.com/users"
+
+// dpopProof describes a proof to sign; the zero value of each field gives a valid proof
+type dpopProof struct {
+	typ        string
+	privateJWK bool
+	method     jwt.SigningMethod
+	htm        string
+	htu        string
+	iat        *time.Time
+	noIat      bool
+	ath        string
+	jti        string
+	noJti      bool
+}
+
+// sign returns the proof as a JWT signed with key
+func (p dpopProof) sign(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	claims := dpopClaims{Htm: "GET", Htu: dpopTestURL, Ath: p.ath}
+	if p.htm != "" {
+		claims.Htm = p.htm
+	}
+	if p.htu != "" {
+		claims.Htu = p.htu
+	}
+	if !p.noIat {
+		issuedAt := time.Now()
+		if p.iat != nil {
+			issuedAt = *p.iat
+		}
+		claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+	}
+	if !p.noJti {
+		claims.ID = p.jti
+		if claims.ID == "" {
+			claims.ID, _ = RandomString(16)
+		}
+	}
+
+	method := p.method
+	if method == nil {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["typ"] = "dpop+jwt"
+	if p.typ != "" {
+		token.Header["typ"] = p.typ
+	}
+
+	var jwk jose.JSONWebKey
+	if p.privateJWK {
+		jwk = jose.JSONWebKey{Key: key}
+	} else {
+		jwk = jose.JSONWebKey{Key: &key.PublicKey}
+	}
+	encoded, _ := jwk.MarshalJSON()
+	var header map[string]interface{}
+	json.Unmarshal(encoded, &header)
+	token.Header["jwk"] = header
+
+	var signingKey interface{} = key
+	if method == jwt.SigningMethodHS256 {
+		signingKey = []byte("shared")
+	}
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestValidateDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	thumbprint, _ := (&jose.JSONWebKey{Key: &key.PublicKey}).Thumbprint(crypto.SHA256)
+	wantJkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	const accessToken = "access-token"
+	hash := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(hash[:])
+	old, future := time.Now().Add(-dpopProofMaxAge-time.Minute), time.Now().Add(dpopClockSkew+time.Minute)
+
+	tests := []struct {
+		name        string
+		proof       dpopProof
+		accessToken string
+		ok          bool
+	}{
+		{name: "valid", ok: true},
+		{name: "valid for an access token", proof: dpopProof{ath: ath}, accessToken: accessToken, ok: true},
+		{name: "wrong typ", proof: dpopProof{typ: "JWT"}},
+		{name: "private key in the header", proof: dpopProof{privateJWK: true}},
+		{name: "symmetric algorithm", proof: dpopProof{method: jwt.SigningMethodHS256}},
+		{name: "other method", proof: dpopProof{htm: "POST"}},
+		{name: "other URL", proof: dpopProof{htu: "https://api.example.com/tokens"}},
+		{name: "URL with a query", proof: dpopProof{htu: dpopTestURL + "?page=2"}},
+		{name: "no iat", proof: dpopProof{noIat: true}},
+		{name: "too old", proof: dpopProof{iat: &old}},
+		{name: "from the future", proof: dpopProof{iat: &future}},
+		{name: "no ath for an access token", accessToken: accessToken},
+		{name: "ath of another token", proof: dpopProof{ath: ath}, accessToken: "other-token"},
+		{name: "no jti", proof: dpopProof{noJti: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jkt, err := ValidateDPoPProof(test.proof.sign(t, key), "GET", dpopTestURL, test.accessToken)
+			if (err == nil) != test.ok {
+				t.Fatalf("ValidateDPoPProof error = %v, want ok %v", err, test.ok)
+			}
+			if test.ok && jkt != wantJkt {
+				t.Fatalf("jkt = %q, want the key's thumbprint %q", jkt, wantJkt)
+			}
+		})
+	}
+}
+
+func TestValidateDPoPProofRejectsReplay(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	proof := dpopProof{}.sign(t, key)
+
+	if _, err := ValidateDPoPProof(proof, "GET", dpopTestURL, ""); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := ValidateDPoPProof(proof, "GET", dpopTestURL, ""); err == nil {
+		t.Fatal("replayed proof was accepted")
+	}
+}
+
+func TestRememberDPoPProofForgetsExpiredProofs(t *testing.T) {
+	longAgo := time.Now().Add(-time.Hour)
+	if !rememberDPoPProof("expired-jti", longAgo) {
+		t.Fatal("unseen jti was reported as replayed")
+	}
+	// Its proof is too old to be accepted anyway, so the jti may be seen again
+	if !rememberDPoPProof("expired-jti", time.Now()) {
+		t.Fatal("expired jti still blocks")
+	}
+	if rememberDPoPProof("expired-jti", time.Now()) {
+		t.Fatal("jti was accepted twice")
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    string
+		remoteAddr string
+		tls        bool
+		forwarded  string
+		publicURL  string
+		want       string
+	}{
+		{name: "plain", want: "http://api.example.com/users"},
+		{name: "TLS", tls: true, want: "https://api.example.com/users"},
+		{name: "untrusted forwarded scheme", forwarded: "https", want: "http://api.example.com/users"},
+		{name: "trusted proxy", trusted: "10.0.0.0/8", forwarded: "https", want: "https://api.example.com/users"},
+		{name: "trusted proxy address", trusted: "10.0.0.1", forwarded: "HTTPS", want: "https://api.example.com/users"},
+		{name: "chain of proxies", trusted: "10.0.0.0/8", forwarded: "https, http", want: "https://api.example.com/users"},
+		{name: "unknown scheme", trusted: "10.0.0.0/8", forwarded: "gopher", want: "http://api.example.com/users"},
+		{name: "request from elsewhere", trusted: "10.0.0.0/8", remoteAddr: "192.0.2.1:1234", forwarded: "https", want: "http://api.example.com/users"},
+		{name: "public base URL", publicURL: "https://public.example.com/", forwarded: "http", want: "https://public.example.com/users"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", test.trusted)
+			t.Setenv("PUBLIC_BASE_URL", test.publicURL)
+			InitializeDPoPHelper()
+			t.Cleanup(func() { dpopTrustedProxies = nil })
+
+			r := httptest.NewRequest("GET", "http://api.example.com/users?page=2", nil)
+			r.RemoteAddr = "10.0.0.1:4321"
+			if test.remoteAddr != "" {
+				r.RemoteAddr = test.remoteAddr
+			}
+			if test.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-Proto", test.forwarded)
+			}
+
+			if got := RequestURL(r); got != test.want {
+				t.Fatalf("RequestURL = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventUserErased is emitted once a user's personal data has been erased
+const EventUserErased = "user.erased"
+
+// Tombstones replacing an erased user's names
+const (
+	ErasedFirstName = "Erased"
+	ErasedLastName  = "User"
+)
+
+// ErrUserAlreadyErased is returned when erasing a user a second time
+var ErrUserAlreadyErased = errors.New("the user has already been erased")
+
+var erasureCertificateCollection *mongo.Collection
+
+// InitializeErasureHelper initializes the package variables after DB connection
+func InitializeErasureHelper() {
+	erasureCertificateCollection = database.GetCollection("erasure_certificates")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A user can only be erased once
+	_, err := erasureCertificateCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("Failed to create erasure certificate index:", err)
+	}
+}
+
+// ErasedEmail returns the tombstone replacing an erased user's email. It stays unique
+// per user and uses a domain that can never receive mail.
+func ErasedEmail(userId string) string {
+	return "erased-" + userId + "@erased.invalid"
+}
+
+// ErasedPhone returns the tombstone replacing an erased user's phone number
+func ErasedPhone(userId string) string {
+	return "erased-" + userId
+}
+
+// EraseUser irreversibly replaces the personal data of a user with tombstones, in their
+// profile and in every collection referencing them. Ids are kept so retained records
+// still line up. The account is deleted as well, and never purged, since the records
+// are kept for a reason. The returned certificate is stored alongside.
+func EraseUser(ctx context.Context, userId string, erasedBy string, reason string) (*models.ErasureCertificate, error) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return nil, err
+	}
+	if user.Erased_at != nil {
+		return nil, ErrUserAlreadyErased
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	certificate := models.ErasureCertificate{
+		ID:        primitive.NewObjectID(),
+		User_id:   userId,
+		Erased_by: erasedBy,
+		Reason:    reason,
+		Erased_at: now,
+	}
+	certificate.Certificate_id = certificate.ID.Hex()
+
+	// Audit entries of failed logins and link requests only carry the address typed in
+	actorFilter := bson.M{"actor_id": userId}
+	if user.Email != nil && *user.Email != "" {
+		actorFilter = bson.M{"$or": []bson.M{
+			{"actor_id": userId},
+			{"actor_email": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(*user.Email) + "$", Options: "i"}},
+		}}
+	}
+
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Stored bundles are removed with the transaction, so a failed erasure keeps them
+		exports, err := deleteDataExports(ctx, bson.M{"user_id": userId})
+		if err != nil {
+			return err
+		}
+		certificate.Records = map[string]int64{"data_exports": exports}
+
+		result, err := userCollection.UpdateOne(ctx,
+			bson.M{"user_id": userId, "erased_at": nil},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{
+					"first_name":    ErasedFirstName,
+					"last_name":     ErasedLastName,
+					"email":         ErasedEmail(userId),
+					"phone":         ErasedPhone(userId),
+					"password":      nil,
+					"token":         nil,
+					"refresh_token": nil,
+					"erased_at":     now,
+					"updated_at":    now,
+					"deleted_at":    bson.M{"$ifNull": bson.A{"$deleted_at", now}},
+					"deleted_by":    bson.M{"$ifNull": bson.A{"$deleted_by", erasedBy}},
+				}}},
+				{{Key: "$unset", Value: bson.A{"identities"}}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrUserAlreadyErased
+		}
+		certificate.Records["users"] = result.ModifiedCount
+
+		scrubs := []struct {
+			name       string
+			collection *mongo.Collection
+			filter     bson.M
+			update     interface{}
+		}{
+			// Where and from what device the user signed in
+			{"login_events", loginEventCollection, bson.M{"user_id": userId}, bson.M{
+				"$set":   bson.M{"ip_address": "", "user_agent": "", "device": "", "country": "", "city": ""},
+				"$unset": bson.M{"latitude": "", "longitude": ""},
+			}},
+			{"magic_links", magicLinkRecordCollection, bson.M{"user_id": userId}, bson.M{
+				"$set": bson.M{"email": ErasedEmail(userId), "ip_address": ""},
+			}},
+			// Token names are chosen by the user; the tokens themselves stop working
+			{"personal_access_tokens", patCollection, bson.M{"user_id": userId}, mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"name": "", "revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", now}}}}},
+			}},
+			// Entries by the user, and changes made to them by others, lose their personal
+			// data; the stored digest keeps the hash chain verifiable
+			{"audit_log", auditCollection, actorFilter, bson.M{
+				"$set":   bson.M{"actor_email": "", "ip_address": "", "user_agent": "", "redacted": true},
+				"$unset": bson.M{"changes": ""},
+			}},
+			{"audit_log", auditCollection, bson.M{"target_id": userId, "changes": bson.M{"$exists": true}}, bson.M{
+				"$set":   bson.M{"redacted": true},
+				"$unset": bson.M{"changes": ""},
+			}},
+			// Events about the user are reduced to their id
+			{"outbox", outboxCollection, bson.M{"aggregate_id": userId}, bson.M{
+				"$set": bson.M{"payload": bson.M{"user_id": userId, "redacted": true}},
+			}},
+			// Queued webhook events carrying the user's data are not sent any more
+			{"webhook_deliveries", webhookDeliveryCollection, bson.M{"payload": primitive.Regex{Pattern: regexp.QuoteMeta(userId)}}, mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{
+					"payload":    "",
+					"status":     bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", DeliveryPending}}, DeliveryFailed, "$status"}},
+					"last_error": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", DeliveryPending}}, "payload erased", "$last_error"}},
+				}}},
+			}},
+		}
+		for _, scrub := range scrubs {
+			result, err := scrub.collection.UpdateMany(ctx, scrub.filter, scrub.update)
+			if err != nil {
+				return err
+			}
+			certificate.Records[scrub.name] += result.ModifiedCount
+		}
+
+		// Passkeys only serve to sign in, which an erased user can no longer do
+		for name, collection := range map[string]*mongo.Collection{
+			"webauthn_credentials": webAuthnCredentialCollection,
+			"webauthn_sessions":    webAuthnSessionCollection,
+		} {
+			result, err := collection.DeleteMany(ctx, bson.M{"user_id": userId})
+			if err != nil {
+				return err
+			}
+			certificate.Records[name] = result.DeletedCount
+		}
+
+		certificate.Hash = ErasureCertificateHash(&certificate)
+		if _, err := erasureCertificateCollection.InsertOne(ctx, certificate); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrUserAlreadyErased
+			}
+			return err
+		}
+		return WriteOutboxEvent(ctx, EventUserErased, userId, map[string]interface{}{"user_id": userId, "certificate_id": certificate.Certificate_id})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	InvalidateUserState(userId)
+	return &certificate, nil
+}
+
+// GetErasureCertificate loads the certificate of erasure of a user
+func GetErasureCertificate(ctx context.Context, userId string) (*models.ErasureCertificate, error) {
+	var certificate models.ErasureCertificate
+	if err := erasureCertificateCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&certificate); err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// ErasureCertificateHash returns the digest sealing a certificate, over a JSON encoding of
+// its fields like audit entries. It is also written to the audit log, whose hash chain
+// then vouches for the certificate.
+func ErasureCertificateHash(certificate *models.ErasureCertificate) string {
+	// Maps are encoded with sorted keys, so the records always hash the same
+	encoded, _ := json.Marshal(struct {
+		CertificateID string           `json:"certificate_id"`
+		UserID        string           `json:"user_id"`
+		ErasedBy      string           `json:"erased_by"`
+		Reason        string           `json:"reason"`
+		ErasedAt      string           `json:"erased_at"`
+		Records       map[string]int64 `json:"records"`
+	}{
+		certificate.Certificate_id,
+		certificate.User_id,
+		certificate.Erased_by,
+		certificate.Reason,
+		certificate.Erased_at.UTC().Format(time.RFC3339Nano),
+		certificate.Records,
+	})
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+)
+
+func TestErasureCertificateHashSeparatesFields(t *testing.T) {
+	certificate := func(erasedBy string, reason string, records map[string]int64) *models.ErasureCertificate {
+		return &models.ErasureCertificate{
+			Certificate_id: "certificate-1",
+			User_id:        "user-1",
+			Erased_by:      erasedBy,
+			Reason:         reason,
+			Records:        records,
+			Erased_at:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+	}
+	records := map[string]int64{"users": 1, "login_events": 12, "personal_access_tokens": 2}
+
+	// A newline moved from one field into the next must change the hash
+	if ErasureCertificateHash(certificate("admin-1\nrequest", "gdpr", records)) == ErasureCertificateHash(certificate("admin-1", "request\ngdpr", records)) {
+		t.Fatal("hash does not tell the fields apart")
+	}
+
+	// The records hash the same whatever order the map iterates in
+	hash := ErasureCertificateHash(certificate("admin-1", "gdpr", records))
+	for range 10 {
+		if ErasureCertificateHash(certificate("admin-1", "gdpr", records)) != hash {
+			t.Fatal("hash of the same certificate changed")
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Formats users can be imported from
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// Outcomes of an imported row
+const (
+	ImportCreated = "created"
+	ImportValid   = "valid"
+	ImportFailed  = "failed"
+)
+
+// ImportMaxRows bounds the number of rows accepted in one import
+const ImportMaxRows = 10000
+
+// importColumns are the fields a row may have, as CSV columns or NDJSON keys
+var importColumns = []string{"first_name", "last_name", "email", "phone", "user_type", "password_hash"}
+
+var importValidate = validator.New()
+
+// ImportRow is one user read from an import file. Password_hash must be a bcrypt hash;
+// without one the account is created without a password and must set one first.
+type ImportRow struct {
+	Line          int    `json:"-"`
+	Parse_error   string `json:"-"`
+	First_name    string `json:"first_name"`
+	Last_name     string `json:"last_name"`
+	Email         string `json:"email"`
+	Phone         string `json:"phone"`
+	User_type     string `json:"user_type"`
+	Password_hash string `json:"password_hash"`
+}
+
+// ImportRowResult reports what happened to one row
+type ImportRowResult struct {
+	Line    int      `json:"line"`
+	Email   string   `json:"email,omitempty"`
+	Status  string   `json:"status"`
+	User_id string   `json:"user_id,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ImportReport is the per-row outcome of an import
+type ImportReport struct {
+	Dry_run bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Valid   int               `json:"valid"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportFormat picks the import format from an explicit name, a content type or a file name
+func ImportFormat(format string, contentType string, filename string) (string, error) {
+	switch {
+	case format != "":
+	case strings.Contains(contentType, "csv") || strings.HasSuffix(filename, ".csv"):
+		format = ImportCSV
+	case strings.Contains(contentType, "ndjson") || strings.Contains(contentType, "jsonl") ||
+		strings.HasSuffix(filename, ".ndjson") || strings.HasSuffix(filename, ".jsonl"):
+		format = ImportNDJSON
+	}
+
+	if format != ImportCSV && format != ImportNDJSON {
+		return "", errors.New("format must be csv or ndjson")
+	}
+	return format, nil
+}
+
+// ParseImport reads the rows of an import file. CSV files start with a header naming
+// the columns; NDJSON files hold one object per line. Malformed rows are returned with
+// a parse error so they show up in the report; a malformed file is an error.
+func ParseImport(r io.Reader, format string) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	if format == ImportCSV {
+		rows, err = parseImportCSV(r)
+	} else {
+		rows, err = parseImportNDJSON(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("the file contains no rows")
+	}
+	if len(rows) > ImportMaxRows {
+		return nil, fmt.Errorf("the file contains more than %d rows", ImportMaxRows)
+	}
+	return rows, nil
+}
+
+func parseImportCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(importColumns, name) {
+			return nil, fmt.Errorf("unknown column %q; expected %s", name, strings.Join(importColumns, ", "))
+		}
+		columns[name] = i
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, ImportRow{
+			Line:          line,
+			First_name:    value("first_name"),
+			Last_name:     value("last_name"),
+			Email:         value("email"),
+			Phone:         value("phone"),
+			User_type:     value("user_type"),
+			Password_hash: value("password_hash"),
+		})
+		if len(rows) > ImportMaxRows {
+			break
+		}
+	}
+	return rows, nil
+}
+
+func parseImportNDJSON(r io.Reader) ([]ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rows []ImportRow
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := ImportRow{Line: line}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			row = ImportRow{Line: line, Parse_error: "invalid JSON: " + err.Error()}
+		}
+		row.Line = line
+		rows = append(rows, row)
+		if len(rows) > ImportMaxRows {
+			break
+		}
+	}
+	return rows, scanner.Err()
+}
+
+// ImportUsers validates the rows like a signup, rejects emails and phone numbers that
+// are taken or repeated in the file, and unless dryRun creates the remaining users.
+// Imported accounts are active and get no tokens; they sign in like everyone else.
+func ImportUsers(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	takenEmails, takenPhones, err := findTakenContacts(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Dry_run: dryRun, Total: len(rows), Rows: make([]ImportRowResult, 0, len(rows))}
+	seenEmails := map[string]int{}
+	seenPhones := map[string]int{}
+
+	for _, row := range rows {
+		result := ImportRowResult{Line: row.Line, Email: row.Email}
+		user, errs := importedUser(row)
+
+		if row.Email != "" {
+			if takenEmails[row.Email] {
+				errs = append(errs, "email already exists")
+			} else if line, ok := seenEmails[row.Email]; ok {
+				errs = append(errs, "email repeats line "+strconv.Itoa(line))
+			} else {
+				seenEmails[row.Email] = row.Line
+			}
+		}
+		if row.Phone != "" {
+			if takenPhones[row.Phone] {
+				errs = append(errs, "phone number already exists")
+			} else if line, ok := seenPhones[row.Phone]; ok {
+				errs = append(errs, "phone number repeats line "+strconv.Itoa(line))
+			} else {
+				seenPhones[row.Phone] = row.Line
+			}
+		}
+
+		switch {
+		case len(errs) > 0:
+			result.Status = ImportFailed
+			result.Errors = errs
+		case dryRun:
+			result.Status = ImportValid
+		default:
+			if err := createImportedUser(ctx, user); err != nil {
+				result.Status = ImportFailed
+				result.Errors = []string{"user could not be created: " + err.Error()}
+			} else {
+				result.Status = ImportCreated
+				result.User_id = user.User_id
+			}
+		}
+
+		switch result.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportValid:
+			report.Valid++
+		default:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	return report, nil
+}
+
+// importedUser turns a row into a user and returns every validation error of the row
+func importedUser(row ImportRow) (models.User, []string) {
+	if row.Parse_error != "" {
+		return models.User{}, []string{row.Parse_error}
+	}
+	if row.User_type == "" {
+		row.User_type = "USER"
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	status := StatusActive
+	// The phone number is optional, and left unset like on accounts from an identity provider
+	var phone *string
+	if row.Phone != "" {
+		phone = &row.Phone
+	}
+	user := models.User{
+		ID:         primitive.NewObjectID(),
+		First_name: &row.First_name,
+		Last_name:  &row.Last_name,
+		Email:      &row.Email,
+		Phone:      phone,
+		User_type:  &row.User_type,
+		Status:     &status,
+		Created_at: now,
+		Updated_at: now,
+	}
+	user.User_id = user.ID.Hex()
+
+	var errs []string
+	var validationErr error
+	if row.Password_hash != "" {
+		user.Password = &row.Password_hash
+		validationErr = importValidate.Struct(user)
+		if _, err := bcrypt.Cost([]byte(row.Password_hash)); err != nil {
+			errs = append(errs, "password_hash is not a bcrypt hash")
+		}
+	} else {
+		user.Password_reset_required = true
+		validationErr = importValidate.StructExcept(user, "Password")
+	}
+
+	if validationErr != nil {
+		errs = append(errs, ValidationErrorMessages(validationErr)...)
+	}
+	return user, errs
+}
+
+// findTakenContacts returns the emails and phone numbers of the rows that already belong
+// to a user, including deleted users that may still be restored
+func findTakenContacts(ctx context.Context, rows []ImportRow) (map[string]bool, map[string]bool, error) {
+	var emails, phones []string
+	for _, row := range rows {
+		if row.Email != "" {
+			emails = append(emails, row.Email)
+		}
+		if row.Phone != "" {
+			phones = append(phones, row.Phone)
+		}
+	}
+
+	cursor, err := userCollection.Find(ctx,
+		bson.M{"$or": []bson.M{
+			{"email": bson.M{"$in": emails}},
+			{"phone": bson.M{"$in": phones}},
+		}},
+		options.Find().SetProjection(bson.M{"email": 1, "phone": 1}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, nil, err
+	}
+
+	takenEmails, takenPhones := map[string]bool{}, map[string]bool{}
+	for _, user := range users {
+		if user.Email != nil {
+			takenEmails[*user.Email] = true
+		}
+		if user.Phone != nil {
+			takenPhones[*user.Phone] = true
+		}
+	}
+	return takenEmails, takenPhones, nil
+}
+
+// createImportedUser stores an imported user together with its created event
+func createImportedUser(ctx context.Context, user models.User) error {
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := userCollection.InsertOne(ctx, user); err != nil {
+			return err
+		}
+		return WriteOutboxEvent(ctx, EventUserCreated, user.User_id, UserEventData(user))
+	})
+}
@@ -0,0 +1,172 @@
+package helpers
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Supported values for ACCESS_TOKEN_ENCRYPTION and REFRESH_TOKEN_ENCRYPTION
+const (
+	EncryptionNone   = "none"
+	EncryptionDirect = "dir"
+	EncryptionRSA    = "RSA-OAEP-256"
+)
+
+var accessTokenEncrypter jose.Encrypter
+var refreshTokenEncrypter jose.Encrypter
+var jweDirectKey []byte
+var jweRSAKey *rsa.PrivateKey
+
+// InitializeJWEHelper configures optional encryption of issued tokens. When enabled,
+// the signed JWT is wrapped in a compact JWE (nested JWS-in-JWE) so that claims such
+// as email and names are not readable by whoever holds the token.
+//
+// ACCESS_TOKEN_ENCRYPTION and REFRESH_TOKEN_ENCRYPTION select "none", "dir" (A256GCM
+// with the 32 byte base64 key in JWE_DIRECT_KEY) or "RSA-OAEP-256" (A256GCM content
+// encryption with the PEM private key at JWE_RSA_PRIVATE_KEY_FILE). Once a type of
+// token is encrypted, plain tokens of that type are refused.
+func InitializeJWEHelper() {
+	var err error
+
+	if raw := os.Getenv("JWE_DIRECT_KEY"); raw != "" {
+		jweDirectKey, err = base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			jweDirectKey, err = base64.RawURLEncoding.DecodeString(raw)
+		}
+		if err != nil || len(jweDirectKey) != 32 {
+			log.Fatal("JWE_DIRECT_KEY must be a base64 encoded 32 byte key")
+		}
+	}
+
+	if path := os.Getenv("JWE_RSA_PRIVATE_KEY_FILE"); path != "" {
+		jweRSAKey, err = loadRSAPrivateKey(path)
+		if err != nil {
+			log.Fatal("Failed to load JWE_RSA_PRIVATE_KEY_FILE: ", err)
+		}
+	}
+
+	accessTokenEncrypter, err = newTokenEncrypter(os.Getenv("ACCESS_TOKEN_ENCRYPTION"))
+	if err != nil {
+		log.Fatal("Invalid ACCESS_TOKEN_ENCRYPTION: ", err)
+	}
+
+	refreshTokenEncrypter, err = newTokenEncrypter(os.Getenv("REFRESH_TOKEN_ENCRYPTION"))
+	if err != nil {
+		log.Fatal("Invalid REFRESH_TOKEN_ENCRYPTION: ", err)
+	}
+}
+
+// newTokenEncrypter returns the encrypter for a mode, or nil when encryption is off
+func newTokenEncrypter(mode string) (jose.Encrypter, error) {
+	opts := (&jose.EncrypterOptions{}).WithContentType("JWT").WithType("JWT")
+
+	switch mode {
+	case "", EncryptionNone:
+		return nil, nil
+	case EncryptionDirect:
+		if jweDirectKey == nil {
+			return nil, fmt.Errorf("%s requires JWE_DIRECT_KEY", mode)
+		}
+		return jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: jweDirectKey}, opts)
+	case EncryptionRSA:
+		if jweRSAKey == nil {
+			return nil, fmt.Errorf("%s requires JWE_RSA_PRIVATE_KEY_FILE", mode)
+		}
+		return jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &jweRSAKey.PublicKey}, opts)
+	default:
+		return nil, fmt.Errorf("unsupported mode %q", mode)
+	}
+}
+
+// loadRSAPrivateKey reads a PKCS#1 or PKCS#8 PEM encoded RSA private key
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not an RSA private key")
+	}
+	return key, nil
+}
+
+// encryptToken wraps a signed JWT in a JWE when an encrypter is configured
+func encryptToken(encrypter jose.Encrypter, signedToken string) (string, error) {
+	if encrypter == nil {
+		return signedToken, nil
+	}
+
+	object, err := encrypter.Encrypt([]byte(signedToken))
+	if err != nil {
+		return "", err
+	}
+	return object.CompactSerialize()
+}
+
+// tokenEncrypter returns the encrypter configured for a token type, nil when tokens of
+// the type are not encrypted. Tokens without a type are access tokens.
+func tokenEncrypter(typ string) jose.Encrypter {
+	if typ == TokenTypeRefresh {
+		return refreshTokenEncrypter
+	}
+	return accessTokenEncrypter
+}
+
+// decryptToken returns the inner signed JWT of an encrypted token and whether it was
+// encrypted. Plain JWS tokens (three segments) are returned unchanged.
+func decryptToken(token string) (string, bool, error) {
+	if strings.Count(token, ".") != 4 {
+		return token, false, nil
+	}
+
+	object, err := jose.ParseEncrypted(token,
+		[]jose.KeyAlgorithm{jose.DIRECT, jose.RSA_OAEP_256},
+		[]jose.ContentEncryption{jose.A256GCM},
+	)
+	if err != nil {
+		return "", true, err
+	}
+
+	var key interface{}
+	switch jose.KeyAlgorithm(object.Header.Algorithm) {
+	case jose.DIRECT:
+		if jweDirectKey != nil {
+			key = jweDirectKey
+		}
+	case jose.RSA_OAEP_256:
+		if jweRSAKey != nil {
+			key = jweRSAKey
+		}
+	}
+	if key == nil {
+		return "", true, fmt.Errorf("no decryption key configured for %s", object.Header.Algorithm)
+	}
+
+	plaintext, err := object.Decrypt(key)
+	if err != nil {
+		return "", true, err
+	}
+	return string(plaintext), true, nil
+}
@@ -0,0 +1,185 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTokenEncryption configures the encryption of access and refresh tokens for a test
+func useTokenEncryption(t *testing.T, access string, refresh string) {
+	t.Helper()
+	SECRET_KEY = "test-secret"
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	jweDirectKey = make([]byte, 32)
+	rand.Read(jweDirectKey)
+	jweRSAKey = key
+
+	if accessTokenEncrypter, err = newTokenEncrypter(access); err != nil {
+		t.Fatalf("access encrypter: %v", err)
+	}
+	if refreshTokenEncrypter, err = newTokenEncrypter(refresh); err != nil {
+		t.Fatalf("refresh encrypter: %v", err)
+	}
+	t.Cleanup(func() {
+		jweDirectKey, jweRSAKey, accessTokenEncrypter, refreshTokenEncrypter = nil, nil, nil, nil
+	})
+}
+
+func TestEncryptedTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		access  string
+		refresh string
+	}{
+		{name: "plain", access: EncryptionNone, refresh: EncryptionNone},
+		{name: "direct", access: EncryptionDirect, refresh: EncryptionDirect},
+		{name: "RSA", access: EncryptionRSA, refresh: EncryptionRSA},
+		{name: "only refresh tokens", access: EncryptionNone, refresh: EncryptionDirect},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTokenEncryption(t, test.access, test.refresh)
+
+			token, refreshToken, err := GenerateAllTokens("jane@example.com", "Jane", "Doe", "USER", "user-1")
+			if err != nil {
+				t.Fatalf("GenerateAllTokens: %v", err)
+			}
+
+			for _, issued := range []struct {
+				token string
+				mode  string
+				typ   string
+			}{{token, test.access, TokenTypeAccess}, {refreshToken, test.refresh, TokenTypeRefresh}} {
+				// Compact JWE has five segments and hides the claims, JWS has three
+				segments := strings.Count(issued.token, ".") + 1
+				if encrypted := issued.mode != EncryptionNone; encrypted != (segments == 5) {
+					t.Fatalf("%s token has %d segments in mode %s", issued.typ, segments, issued.mode)
+				}
+				if exposes := exposesClaim(issued.token, "jane@example.com"); exposes != (issued.mode == EncryptionNone) {
+					t.Fatalf("%s token in mode %s exposes the email: %v", issued.typ, issued.mode, exposes)
+				}
+
+				claims, msg := ValidateToken(issued.token)
+				if msg != "" || claims.Email != "jane@example.com" || claims.Typ != issued.typ {
+					t.Fatalf("ValidateToken(%s) = %+v, %q", issued.typ, claims, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTokenRefusesUnprotectedTokens(t *testing.T) {
+	SECRET_KEY = "test-secret"
+	plainAccess, plainRefresh, err := GenerateAllTokens("jane@example.com", "Jane", "Doe", "USER", "user-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+
+	useTokenEncryption(t, EncryptionDirect, EncryptionNone)
+	encrypted, _, err := GenerateAllTokens("jane@example.com", "Jane", "Doe", "USER", "user-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+	segments := strings.Split(encrypted, ".")
+	ciphertext := []byte(segments[3])
+	ciphertext[0] ^= 1
+	segments[3] = string(ciphertext)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "plain access token once access tokens are encrypted", token: plainAccess, want: MsgTokenInvalid},
+		{name: "plain refresh token while refresh tokens are not", token: plainRefresh, want: ""},
+		{name: "tampered ciphertext", token: strings.Join(segments, "."), want: MsgTokenInvalid},
+		{name: "encrypted for another key", token: encryptedWithOtherKey(t, plainAccess), want: MsgTokenInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, msg := ValidateToken(test.token); msg != test.want {
+				t.Fatalf("ValidateToken = %q, want %q", msg, test.want)
+			}
+		})
+	}
+}
+
+// exposesClaim reports whether any segment of a token decodes to text containing value
+func exposesClaim(token string, value string) bool {
+	for _, segment := range strings.Split(token, ".") {
+		if decoded, err := base64.RawURLEncoding.DecodeString(segment); err == nil && strings.Contains(string(decoded), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptedWithOtherKey wraps a signed token in a JWE under a key the server does not hold
+func encryptedWithOtherKey(t *testing.T, signedToken string) string {
+	t.Helper()
+	other := make([]byte, 32)
+	rand.Read(other)
+
+	previous := jweDirectKey
+	jweDirectKey = other
+	encrypter, err := newTokenEncrypter(EncryptionDirect)
+	jweDirectKey = previous
+	if err != nil {
+		t.Fatalf("newTokenEncrypter: %v", err)
+	}
+	token, err := encryptToken(encrypter, signedToken)
+	if err != nil {
+		t.Fatalf("encryptToken: %v", err)
+	}
+	return token
+}
+
+func TestNewTokenEncrypterRequiresKeys(t *testing.T) {
+	jweDirectKey, jweRSAKey = nil, nil
+	for _, mode := range []string{EncryptionDirect, EncryptionRSA, "A128KW"} {
+		if _, err := newTokenEncrypter(mode); err == nil {
+			t.Fatalf("newTokenEncrypter(%q) succeeded without a key", mode)
+		}
+	}
+}
+
+func TestLoadRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	tests := []struct {
+		name  string
+		block *pem.Block
+		ok    bool
+	}{
+		{name: "PKCS#1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, ok: true},
+		{name: "PKCS#8", block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}, ok: true},
+		{name: "not a key", block: &pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, pem.EncodeToMemory(test.block), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := loadRSAPrivateKey(path)
+			if (err == nil) != test.ok || (test.ok && !loaded.Equal(key)) {
+				t.Fatalf("loadRSAPrivateKey = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"github.com/oschwald/geoip2-golang"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How many earlier logins a new one is compared against
+const loginHistorySize = 50
+
+// GeoIP locations are coarse, so short hops are never treated as travel
+const minTravelDistanceKm = 300
+
+// LoginRiskMFA forces a passkey challenge on risky logins. Users without a passkey
+// cannot be challenged; their risky logins go ahead and only send the unusual sign-in email.
+var LoginRiskMFA bool
+
+var loginEventCollection *mongo.Collection
+var geoIPReader *geoip2.Reader
+var maxTravelSpeed = 900.0
+var loginNotifications = true
+
+// InitializeLoginRiskHelper initializes the package variables after DB connection.
+// GEOIP_DB_PATH points to a local GeoLite2/GeoIP2 City database used to locate logins;
+// without it only new devices are detected. LOGIN_MAX_TRAVEL_SPEED (km/h, default 900)
+// bounds how fast a user can plausibly move between two logins, LOGIN_NOTIFICATIONS=false
+// turns off new sign-in emails and LOGIN_RISK_MFA=true requires a passkey for risky logins
+// of users who have one.
+func InitializeLoginRiskHelper() {
+	loginEventCollection = database.GetCollection("login_events")
+
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			log.Fatal("Failed to open GEOIP_DB_PATH: ", err)
+		}
+		geoIPReader = reader
+	}
+
+	if raw := os.Getenv("LOGIN_MAX_TRAVEL_SPEED"); raw != "" {
+		speed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || speed <= 0 {
+			log.Fatal("LOGIN_MAX_TRAVEL_SPEED must be a positive number of km/h")
+		}
+		maxTravelSpeed = speed
+	}
+	loginNotifications = os.Getenv("LOGIN_NOTIFICATIONS") != "false"
+	LoginRiskMFA = os.Getenv("LOGIN_RISK_MFA") == "true"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Login history is always read newest first per user
+	_, err := loginEventCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		log.Println("Failed to create login event index:", err)
+	}
+}
+
+// AssessLogin fingerprints a login and compares it with the user's earlier logins.
+// The returned event is not stored; pass it to RecordLoginEvent once the login succeeds.
+func AssessLogin(ctx context.Context, userId string, method string, ipAddress string, userAgent string) *models.LoginEvent {
+	event := &models.LoginEvent{
+		ID:         primitive.NewObjectID(),
+		User_id:    userId,
+		Method:     method,
+		Ip_address: ipAddress,
+		User_agent: userAgent,
+		Device:     DescribeDevice(userAgent),
+		Created_at: time.Now().UTC(),
+	}
+	event.Event_id = event.ID.Hex()
+	locateLogin(event)
+
+	// Ensure initialization
+	if loginEventCollection == nil {
+		return event
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(loginHistorySize)
+	cursor, err := loginEventCollection.Find(ctx, bson.M{"user_id": userId}, opts)
+	if err != nil {
+		log.Println("Failed to load login history:", err)
+		return event
+	}
+
+	var history []models.LoginEvent
+	if err := cursor.All(ctx, &history); err != nil {
+		log.Println("Failed to load login history:", err)
+		return event
+	}
+
+	compareLoginHistory(event, history)
+	return event
+}
+
+// compareLoginHistory flags what is new about a located login compared with the user's
+// earlier logins, newest first
+func compareLoginHistory(event *models.LoginEvent, history []models.LoginEvent) {
+	// Nothing is unusual about the very first login
+	if len(history) == 0 {
+		return
+	}
+
+	event.New_device = true
+	seenCountry := false
+	knownCountries := map[string]bool{}
+	var lastLocated *models.LoginEvent
+	for i, previous := range history {
+		if previous.Device == event.Device {
+			event.New_device = false
+		}
+		if previous.Country != "" {
+			knownCountries[previous.Country] = true
+			seenCountry = true
+		}
+		if lastLocated == nil && previous.Latitude != nil && previous.Longitude != nil {
+			lastLocated = &history[i]
+		}
+	}
+
+	// A country only counts as new once earlier logins could be located at all
+	event.New_country = seenCountry && event.Country != "" && !knownCountries[event.Country]
+
+	// Impossible travel: the distance from the last located login could not have been covered in time
+	if lastLocated != nil && event.Latitude != nil && event.Longitude != nil {
+		distance := haversineKm(*lastLocated.Latitude, *lastLocated.Longitude, *event.Latitude, *event.Longitude)
+		hours := math.Max(event.Created_at.Sub(lastLocated.Created_at).Hours(), 1.0/60)
+		event.Impossible_travel = distance >= minTravelDistanceKm && distance/hours > maxTravelSpeed
+	}
+
+	event.Risky = event.Impossible_travel || (event.New_device && event.New_country)
+}
+
+// RecordLoginEvent stores a successful login and tells the user about new or risky sign-ins
+func RecordLoginEvent(ctx context.Context, user models.User, event *models.LoginEvent) {
+	// Ensure initialization
+	if loginEventCollection == nil {
+		return
+	}
+
+	if _, err := loginEventCollection.InsertOne(ctx, event); err != nil {
+		log.Println("Failed to record login event:", err)
+	}
+
+	if !loginNotifications || user.Email == nil || !(event.New_device || event.Risky) {
+		return
+	}
+
+	location := "an unknown location"
+	if event.Country != "" {
+		location = strings.TrimPrefix(event.City+", "+event.Country, ", ")
+	}
+
+	subject := "New sign-in to your account"
+	if event.Risky {
+		subject = "Unusual sign-in to your account"
+	}
+	body := fmt.Sprintf("Your account was just signed in to from %s (%s, IP address %s) at %s.\n\n"+
+		"If this was you, there is nothing to do. If not, change your password right away.\n",
+		event.Device, location, event.Ip_address, event.Created_at.Format(time.RFC1123))
+
+	// Delivery must not hold up the login response
+	to := *user.Email
+	go func() {
+		if err := SendMail(to, subject, body); err != nil {
+			log.Println("Failed to send login notification:", err)
+		}
+	}()
+}
+
+// GetLoginEvents returns the most recent logins of a user
+func GetLoginEvents(ctx context.Context, userId string, limit int64) ([]models.LoginEvent, error) {
+	events := []models.LoginEvent{}
+
+	// Ensure initialization
+	if loginEventCollection == nil {
+		return events, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := loginEventCollection.Find(ctx, bson.M{"user_id": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DescribeDevice reduces a user agent to a coarse "browser on OS" description
+func DescribeDevice(userAgent string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.Contains(userAgent, "curl/"), strings.Contains(userAgent, "Go-http-client/"), strings.Contains(userAgent, "PostmanRuntime/"):
+		browser = "API client"
+	}
+
+	system := "unknown OS"
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"), strings.Contains(userAgent, "Macintosh"):
+		system = "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		system = "ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	return browser + " on " + system
+}
+
+// locateLogin fills in the location of the login's IP address from the GeoIP database
+func locateLogin(event *models.LoginEvent) {
+	if geoIPReader == nil {
+		return
+	}
+
+	ip := net.ParseIP(event.Ip_address)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() {
+		return
+	}
+
+	record, err := geoIPReader.City(ip)
+	if err != nil || record.Country.IsoCode == "" {
+		return
+	}
+
+	event.Country = record.Country.IsoCode
+	event.City = record.City.Names["en"]
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		latitude, longitude := record.Location.Latitude, record.Location.Longitude
+		event.Latitude = &latitude
+		event.Longitude = &longitude
+	}
+}
+
+// haversineKm returns the great-circle distance between two coordinates
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
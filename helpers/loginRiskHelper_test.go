@@ -0,0 +1,95 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+)
+
+func TestCompareLoginHistory(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	login := func(device string, country string, latitude float64, longitude float64, ago time.Duration) models.LoginEvent {
+		event := models.LoginEvent{Device: device, Country: country, Created_at: now.Add(-ago)}
+		if country != "" {
+			event.Latitude, event.Longitude = &latitude, &longitude
+		}
+		return event
+	}
+	const laptop, phone = "Firefox on Linux", "Safari on iOS"
+
+	tests := []struct {
+		name       string
+		event      models.LoginEvent
+		history    []models.LoginEvent
+		newDevice  bool
+		newCountry bool
+		travel     bool
+		risky      bool
+	}{
+		{
+			name:  "first login",
+			event: login(phone, "US", 40.71, -74.01, 0),
+		},
+		{
+			name:    "known device and place",
+			event:   login(laptop, "DE", 52.52, 13.40, 0),
+			history: []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, 24*time.Hour)},
+		},
+		{
+			name:      "new device at home",
+			event:     login(phone, "DE", 52.52, 13.40, 0),
+			history:   []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, 24*time.Hour)},
+			newDevice: true,
+		},
+		{
+			name:       "known device abroad after a flight",
+			event:      login(laptop, "US", 40.71, -74.01, 0),
+			history:    []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, 12*time.Hour)},
+			newCountry: true,
+		},
+		{
+			name:       "new device abroad",
+			event:      login(phone, "US", 40.71, -74.01, 0),
+			history:    []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, 48*time.Hour)},
+			newDevice:  true,
+			newCountry: true,
+			risky:      true,
+		},
+		{
+			name:       "impossible travel",
+			event:      login(laptop, "US", 40.71, -74.01, 0),
+			history:    []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, time.Hour)},
+			newCountry: true,
+			travel:     true,
+			risky:      true,
+		},
+		{
+			name:    "short hop across a border",
+			event:   login(laptop, "PL", 52.35, 14.55, 0),
+			history: []models.LoginEvent{login(laptop, "DE", 52.52, 13.40, time.Minute), login(laptop, "PL", 52.40, 16.92, 48*time.Hour)},
+		},
+		{
+			name:    "travel compared with the last located login",
+			event:   login(laptop, "DE", 52.52, 13.40, 0),
+			history: []models.LoginEvent{login(laptop, "", 0, 0, time.Minute), login(laptop, "DE", 48.14, 11.58, 2*time.Hour)},
+		},
+		{
+			name:      "countries are unknown without located history",
+			event:     login(phone, "US", 40.71, -74.01, 0),
+			history:   []models.LoginEvent{login(laptop, "", 0, 0, time.Hour)},
+			newDevice: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := test.event
+			compareLoginHistory(&event, test.history)
+			if event.New_device != test.newDevice || event.New_country != test.newCountry || event.Impossible_travel != test.travel || event.Risky != test.risky {
+				t.Fatalf("new device %v, new country %v, impossible travel %v, risky %v; want %v, %v, %v, %v",
+					event.New_device, event.New_country, event.Impossible_travel, event.Risky,
+					test.newDevice, test.newCountry, test.travel, test.risky)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain text email
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// SMTPMailer delivers mail through an SMTP relay
+type SMTPMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+// LogMailer writes mail to the log instead of sending it, for development
+type LogMailer struct{}
+
+// DefaultMailer is used by SendMail
+var DefaultMailer Mailer = LogMailer{}
+
+// InitializeMailHelper selects the mailer from the environment. With SMTP_HOST set,
+// mail is sent via SMTP_HOST:SMTP_PORT (default 587) from MAIL_FROM, authenticating
+// with SMTP_USERNAME and SMTP_PASSWORD when given; otherwise it is only logged.
+func InitializeMailHelper() {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		DefaultMailer = LogMailer{}
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		log.Fatal("MAIL_FROM environment variable not set")
+	}
+
+	mailer := SMTPMailer{Addr: host + ":" + port, From: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	DefaultMailer = mailer
+}
+
+// SendMail sends a message with the default mailer
+func SendMail(to string, subject string, body string) error {
+	return DefaultMailer.Send(to, subject, body)
+}
+
+// Send implements Mailer
+func (m SMTPMailer) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header value")
+	}
+
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, []byte(message))
+}
+
+// Send implements Mailer
+func (LogMailer) Send(to string, subject string, body string) error {
+	log.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,164 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProviderConfig holds the settings of one upstream OpenID Connect provider
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCProvider is a discovered upstream provider ready to run the code flow
+type OIDCProvider struct {
+	Config   OIDCProviderConfig
+	OAuth2   oauth2.Config
+	Verifier *oidc.IDTokenVerifier
+}
+
+// OIDCIdentity holds the claims we read from a verified upstream id_token
+type OIDCIdentity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+	AuthTime      int64  `json:"auth_time"`
+}
+
+var oidcConfigs map[string]OIDCProviderConfig
+var oidcProviders = map[string]*OIDCProvider{}
+var oidcMutex sync.Mutex
+
+// InitializeOIDCHelper loads upstream provider settings from the environment.
+// OIDC_PROVIDERS is a comma separated list of names; each name NAME is configured
+// with OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET,
+// OIDC_NAME_REDIRECT_URL and optionally OIDC_NAME_SCOPES.
+func InitializeOIDCHelper() {
+	oidcConfigs = map[string]OIDCProviderConfig{}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+		if raw := os.Getenv(prefix + "SCOPES"); raw != "" {
+			scopes = strings.Fields(strings.ReplaceAll(raw, ",", " "))
+		}
+
+		oidcConfigs[name] = OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+		}
+	}
+}
+
+// OIDCProviderNames returns the names of the configured upstream providers
+func OIDCProviderNames() []string {
+	names := []string{}
+	for name := range oidcConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetOIDCProvider returns the named provider, running discovery on first use
+func GetOIDCProvider(ctx context.Context, name string) (*OIDCProvider, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if provider, ok := oidcProviders[name]; ok {
+		return provider, nil
+	}
+
+	config, ok := oidcConfigs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identity provider %q", name)
+	}
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("identity provider %q is not fully configured", name)
+	}
+
+	// Discover endpoints and signing keys from the issuer
+	discovered, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed for identity provider %q: %w", name, err)
+	}
+
+	provider := &OIDCProvider{
+		Config: config,
+		OAuth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       config.Scopes,
+		},
+		Verifier: discovered.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}
+	oidcProviders[name] = provider
+
+	return provider, nil
+}
+
+// AuthCodeURL builds the authorization redirect carrying state, nonce and a PKCE S256 challenge
+func (p *OIDCProvider) AuthCodeURL(state string, nonce string, verifier string) string {
+	return p.OAuth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// ExchangeOIDCCode redeems an authorization code and returns the verified identity
+func (p *OIDCProvider) ExchangeOIDCCode(ctx context.Context, code string, verifier string, nonce string) (*OIDCIdentity, error) {
+	// Exchange the code using the PKCE verifier from the login step
+	oauthToken, err := p.OAuth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("provider did not return an id_token")
+	}
+
+	// Verify signature, issuer, audience and expiry of the id_token
+	idToken, err := p.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id_token verification failed: %w", err)
+	}
+
+	var identity OIDCIdentity
+	if err := idToken.Claims(&identity); err != nil {
+		return nil, fmt.Errorf("id_token claims are invalid: %w", err)
+	}
+
+	if identity.Nonce != nonce {
+		return nil, fmt.Errorf("id_token nonce does not match")
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+
+	return &identity, nil
+}
@@ -0,0 +1,225 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Domain events written to the outbox
+const (
+	EventSessionRevoked = "session.revoked"
+)
+
+// How long the relay owns an event it is publishing before another relay may take it over
+const outboxLease = 30 * time.Second
+
+// Failed publishes are retried after a delay doubling up to outboxRetryMax
+const outboxRetryMax = 5 * time.Minute
+
+// EventPublisher receives the events relayed from the outbox
+var EventPublisher Publisher = DiscardPublisher{}
+
+var outboxCollection *mongo.Collection
+var outboxPollInterval = 2 * time.Second
+var outboxRetention = 7 * 24 * time.Hour
+
+// InitializeOutboxHelper initializes the package variables after DB connection.
+// OUTBOX_PUBLISHER selects where events go: "none" (the default, events only reach
+// webhooks), "stdout" (NDJSON, for development), "memory" or "nats" (NATS_URL, subjects
+// prefixed with NATS_SUBJECT_PREFIX, default "users").
+// OUTBOX_POLL_INTERVAL is the fallback polling interval when change streams are not
+// available and OUTBOX_RETENTION how long published events are kept.
+func InitializeOutboxHelper() {
+	outboxCollection = database.GetCollection("outbox")
+
+	switch publisher := os.Getenv("OUTBOX_PUBLISHER"); publisher {
+	case "", "none":
+		EventPublisher = DiscardPublisher{}
+	case "stdout":
+		EventPublisher = NewStreamPublisher(os.Stdout)
+	case "memory":
+		EventPublisher = NewMemoryPublisher(1000)
+	case "nats":
+		url := os.Getenv("NATS_URL")
+		if url == "" {
+			url = "nats://127.0.0.1:4222"
+		}
+		prefix := os.Getenv("NATS_SUBJECT_PREFIX")
+		if prefix == "" {
+			prefix = "users"
+		}
+		natsPublisher, err := NewNATSPublisher(url, prefix)
+		if err != nil {
+			log.Fatal("Failed to connect to NATS: ", err)
+		}
+		EventPublisher = natsPublisher
+	default:
+		log.Fatal("OUTBOX_PUBLISHER must be one of none, stdout, memory or nats")
+	}
+
+	if raw := os.Getenv("OUTBOX_POLL_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			log.Fatal("OUTBOX_POLL_INTERVAL must be a positive duration such as 2s")
+		}
+		outboxPollInterval = interval
+	}
+	if raw := os.Getenv("OUTBOX_RETENTION"); raw != "" {
+		retention, err := time.ParseDuration(raw)
+		if err != nil || retention <= 0 {
+			log.Fatal("OUTBOX_RETENTION must be a positive duration such as 168h")
+		}
+		outboxRetention = retention
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The relay looks for unpublished events; published ones expire after the retention period
+	_, err := outboxCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "published_at", Value: 1}}, Options: options.Index().SetName("published_at_ttl").SetExpireAfterSeconds(int32(outboxRetention.Seconds()))},
+	})
+	if err != nil {
+		log.Println("Failed to create outbox indexes:", err)
+	}
+}
+
+// WriteOutboxEvent records a domain event. Pass the ctx of the transaction that makes the
+// change so the event is stored if and only if the change is committed.
+func WriteOutboxEvent(ctx context.Context, eventType string, aggregateId string, payload map[string]interface{}) error {
+	event := models.OutboxEvent{
+		ID:           primitive.NewObjectID(),
+		Type:         eventType,
+		Aggregate_id: aggregateId,
+		Payload:      payload,
+		Created_at:   time.Now().UTC(),
+	}
+	event.Event_id = event.ID.Hex()
+
+	_, err := outboxCollection.InsertOne(ctx, event)
+	return err
+}
+
+// StartOutboxRelay publishes outbox events in the background until ctx is done. New events
+// are picked up through a change stream where available and by polling otherwise.
+func StartOutboxRelay(ctx context.Context) {
+	// Ensure initialization
+	if outboxCollection == nil {
+		return
+	}
+
+	wake := make(chan struct{}, 1)
+	go watchOutbox(ctx, wake)
+
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Publish everything that is pending before waiting again
+			for publishNextOutboxEvent(ctx) {
+			}
+
+			select {
+			case <-ctx.Done():
+				EventPublisher.Close()
+				return
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// watchOutbox signals wake whenever an event is committed to the outbox
+func watchOutbox(ctx context.Context, wake chan<- struct{}) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}
+	stream, err := outboxCollection.Watch(ctx, pipeline)
+	if err != nil {
+		log.Println("Outbox change stream not available, polling every", outboxPollInterval)
+		return
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		log.Println("Outbox change stream stopped, polling every", outboxPollInterval, ":", err)
+	}
+}
+
+// publishNextOutboxEvent claims the oldest unpublished event, publishes it and queues its
+// webhook deliveries. It reports whether an event was found.
+func publishNextOutboxEvent(ctx context.Context) bool {
+	now := time.Now().UTC()
+
+	var event models.OutboxEvent
+	err := outboxCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"published_at": nil,
+			"$or": []bson.M{
+				{"claimed_until": nil},
+				{"claimed_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"claimed_until": now.Add(outboxLease)},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&event)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Println("Failed to claim outbox event:", err)
+		}
+		return false
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err = EventPublisher.Publish(publishCtx, EventMessage{
+		ID:          event.Event_id,
+		Type:        event.Type,
+		AggregateID: event.Aggregate_id,
+		OccurredAt:  event.Created_at,
+		Data:        event.Payload,
+	})
+	if err == nil {
+		err = queueWebhookDeliveries(publishCtx, event)
+	}
+
+	update := bson.M{"published_at": time.Now().UTC(), "claimed_until": nil, "last_error": ""}
+	if err != nil {
+		// Leave the event claimed until it is due for another attempt
+		update = bson.M{"claimed_until": time.Now().UTC().Add(outboxRetryDelay(event.Attempts)), "last_error": err.Error()}
+	}
+
+	if _, err := outboxCollection.UpdateOne(ctx, bson.M{"_id": event.ID}, bson.M{"$set": update}); err != nil {
+		log.Println("Failed to update outbox event:", err)
+	}
+	return true
+}
+
+// outboxRetryDelay returns the wait before publishing again after the given number of attempts
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < outboxRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxRetryMax)
+}
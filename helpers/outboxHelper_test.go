@@ -0,0 +1,166 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// failingPublisher refuses every event
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, message EventMessage) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingPublisher) Close() error {
+	return nil
+}
+
+func TestMemoryPublisherKeepsLatestEvents(t *testing.T) {
+	publisher := NewMemoryPublisher(2)
+	for _, id := range []string{"1", "2", "3"} {
+		if err := publisher.Publish(context.Background(), EventMessage{ID: id, Type: EventUserCreated}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	messages := publisher.Messages()
+	if len(messages) != 2 || messages[0].ID != "2" || messages[1].ID != "3" {
+		t.Fatalf("messages = %+v, want events 2 and 3", messages)
+	}
+
+	// The returned slice is a copy
+	messages[0].ID = "changed"
+	if publisher.Messages()[0].ID != "2" {
+		t.Fatal("Messages returned the publisher's own slice")
+	}
+}
+
+// eventId is the outbox event the relay is handed
+var eventId = primitive.NewObjectID()
+
+// useMockOutbox points the outbox and webhook collections at the mock deployment and
+// publishes events to publisher
+func useMockOutbox(mt *mtest.T, publisher Publisher) {
+	previous := EventPublisher
+	outboxCollection, webhookCollection, webhookDeliveryCollection = mt.Coll, mt.Coll, mt.Coll
+	EventPublisher = publisher
+	mt.Cleanup(func() {
+		outboxCollection, webhookCollection, webhookDeliveryCollection = nil, nil, nil
+		EventPublisher = previous
+	})
+}
+
+// claimedOutboxEvent is the findAndModify reply handing the relay an outbox event
+func claimedOutboxEvent(id primitive.ObjectID, eventType string) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+		{Key: "_id", Value: id},
+		{Key: "event_id", Value: id.Hex()},
+		{Key: "type", Value: eventType},
+		{Key: "aggregate_id", Value: "user-1"},
+		{Key: "payload", Value: bson.D{{Key: "user_id", Value: "user-1"}}},
+		{Key: "created_at", Value: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Key: "attempts", Value: 1},
+	}})
+}
+
+// startedCommands returns the last command of each name the relay sent
+func startedCommands(mt *mtest.T) map[string]bson.Raw {
+	commands := map[string]bson.Raw{}
+	for _, event := range mt.GetAllStartedEvents() {
+		commands[event.CommandName] = event.Command
+	}
+	return commands
+}
+
+func TestOutboxRelayPublishesAndQueuesWebhooks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("published", func(mt *mtest.T) {
+		publisher := NewMemoryPublisher(0)
+		useMockOutbox(mt, publisher)
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			claimedOutboxEvent(eventId, EventUserCreated),
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+				{Key: "webhook_id", Value: "webhook-1"},
+				{Key: "events", Value: bson.A{"*"}},
+				{Key: "active", Value: true},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		if !publishNextOutboxEvent(context.Background()) {
+			mt.Fatal("relay found no event")
+		}
+
+		messages := publisher.Messages()
+		if len(messages) != 1 || messages[0].ID != eventId.Hex() || messages[0].Type != EventUserCreated {
+			mt.Fatalf("published %+v, want the outbox event", messages)
+		}
+
+		commands := startedCommands(mt)
+		delivery := commands["insert"].Lookup("documents", "0").Document()
+		if delivery.Lookup("webhook_id").StringValue() != "webhook-1" || delivery.Lookup("event_id").StringValue() != eventId.Hex() {
+			mt.Fatalf("queued delivery %v, want the outbox event for webhook-1", delivery)
+		}
+		if _, err := commands["update"].Lookup("updates", "0", "u", "$set").Document().LookupErr("published_at"); err != nil {
+			mt.Fatalf("event was not marked published: %v", commands["update"])
+		}
+	})
+
+	mt.Run("relayed again", func(mt *mtest.T) {
+		useMockOutbox(mt, NewMemoryPublisher(0))
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			claimedOutboxEvent(eventId, EventUserCreated),
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+				{Key: "webhook_id", Value: "webhook-1"},
+				{Key: "events", Value: bson.A{"*"}},
+				{Key: "active", Value: true},
+			}),
+			// The delivery was queued before the event was marked published
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		publishNextOutboxEvent(context.Background())
+
+		set := startedCommands(mt)["update"].Lookup("updates", "0", "u", "$set").Document()
+		if _, err := set.LookupErr("published_at"); err != nil {
+			mt.Fatalf("event already queued for the webhook was not marked published: %v", set)
+		}
+	})
+
+	mt.Run("publisher down", func(mt *mtest.T) {
+		useMockOutbox(mt, failingPublisher{})
+
+		mt.AddMockResponses(
+			claimedOutboxEvent(eventId, EventUserCreated),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		publishNextOutboxEvent(context.Background())
+
+		commands := startedCommands(mt)
+		if _, ok := commands["insert"]; ok {
+			mt.Fatal("webhooks were queued for an event that was not published")
+		}
+		set := commands["update"].Lookup("updates", "0", "u", "$set").Document()
+		if _, err := set.LookupErr("published_at"); err == nil {
+			mt.Fatal("unpublished event was marked published")
+		}
+		if set.Lookup("last_error").StringValue() != "broker unavailable" {
+			mt.Fatalf("last_error = %v, want the publisher's error", set.Lookup("last_error"))
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+// Usage is recorded at most this often per token, so busy tokens do not cause a write per request
+const patUsageResolution = time.Minute
+
+var patCollection *mongo.Collection
+
+// InitializePATHelper initializes the package variables after DB connection
+func InitializePATHelper() {
+	patCollection = database.GetCollection("personal_access_tokens")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Tokens are looked up by hash on every request
+	_, err := patCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("Failed to create personal access token index:", err)
+	}
+}
+
+// IsPersonalAccessToken reports whether the presented credential is a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashPersonalAccessToken returns the value stored in place of the plain token
+func HashPersonalAccessToken(token string) string {
+	return HashSecret(token)
+}
+
+// GeneratePersonalAccessToken creates a new random token and returns it with its hash and display prefix
+func GeneratePersonalAccessToken() (token string, hash string, prefix string, err error) {
+	secret, err := RandomString(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	token = PersonalAccessTokenPrefix + secret
+	return token, HashPersonalAccessToken(token), token[:len(PersonalAccessTokenPrefix)+8], nil
+}
+
+// ValidatePersonalAccessToken looks up a personal access token and returns claims for its owner
+func ValidatePersonalAccessToken(token string) (claims *SignedDetails, msg string) {
+	// Ensure initialization
+	if patCollection == nil || userCollection == nil {
+		return nil, "token helper not initialized"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var pat models.PersonalAccessToken
+	err := patCollection.FindOne(ctx, bson.M{"token_hash": HashPersonalAccessToken(token)}).Decode(&pat)
+	if err != nil {
+		return nil, MsgTokenInvalid
+	}
+
+	if pat.Revoked_at != nil {
+		return nil, MsgTokenRevoked
+	}
+	if pat.Expires_at != nil && pat.Expires_at.Before(time.Now()) {
+		return nil, MsgTokenExpired
+	}
+
+	// Claims without a scope grant everything, so a token must never end up with none
+	scope := strings.Join(strings.Fields(strings.Join(pat.Scopes, " ")), " ")
+	if scope == "" {
+		return nil, MsgTokenInvalid
+	}
+
+	// Load the owner so handlers see the same context as with a JWT
+	var user models.User
+	err = userCollection.FindOne(ctx, NotDeleted(bson.M{"user_id": pat.User_id})).Decode(&user)
+	if err != nil || user.Email == nil || user.User_type == nil {
+		return nil, MsgTokenInvalid
+	}
+
+	// Record usage, unless it was recorded a moment ago. The filter keeps concurrent
+	// requests from all writing it.
+	now := time.Now().UTC()
+	stale := now.Add(-patUsageResolution)
+	if pat.Last_used_at == nil || pat.Last_used_at.Before(stale) {
+		_, err = patCollection.UpdateOne(ctx,
+			bson.M{"_id": pat.ID, "$or": []bson.M{
+				{"last_used_at": nil},
+				{"last_used_at": bson.M{"$lt": stale}},
+			}},
+			bson.M{"$set": bson.M{"last_used_at": now}},
+		)
+		if err != nil {
+			log.Println("Failed to record personal access token usage:", err)
+		}
+	}
+
+	claims = &SignedDetails{
+		Email:     *user.Email,
+		Uid:       user.User_id,
+		User_type: *user.User_type,
+		Scope:     scope,
+	}
+	if user.First_name != nil {
+		claims.First_name = *user.First_name
+	}
+	if user.Last_name != nil {
+		claims.Last_name = *user.Last_name
+	}
+
+	return claims, ""
+}
+
+// RevokePersonalAccessTokens revokes every active personal access token of a user
+func RevokePersonalAccessTokens(ctx context.Context, userId string) error {
+	_, err := patCollection.UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}},
+	)
+	return err
+}
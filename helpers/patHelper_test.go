@@ -0,0 +1,100 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGeneratePersonalAccessToken(t *testing.T) {
+	token, hash, prefix, err := GeneratePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("GeneratePersonalAccessToken: %v", err)
+	}
+	if !IsPersonalAccessToken(token) || IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatalf("token %q is not told apart from a JWT", token)
+	}
+	if hash != HashPersonalAccessToken(token) || hash == token {
+		t.Fatal("stored hash does not match the token")
+	}
+	if len(prefix) != len(PersonalAccessTokenPrefix)+8 || token[:len(prefix)] != prefix {
+		t.Fatalf("prefix %q does not start the token", prefix)
+	}
+}
+
+func TestValidatePersonalAccessToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	now := time.Now().UTC()
+	owner := bson.D{{Key: "user_id", Value: "user-1"}, {Key: "email", Value: "jane@example.com"}, {Key: "user_type", Value: "USER"}}
+
+	tests := []struct {
+		name     string
+		pat      bson.D
+		user     bson.D
+		wantMsg  string
+		wantUsed bool
+	}{
+		{name: "unknown", wantMsg: MsgTokenInvalid},
+		{name: "revoked", pat: bson.D{{Key: "revoked_at", Value: now.Add(-time.Hour)}}, wantMsg: MsgTokenRevoked},
+		{name: "expired", pat: bson.D{{Key: "expires_at", Value: now.Add(-time.Hour)}}, wantMsg: MsgTokenExpired},
+		{name: "stored empty scope", pat: bson.D{{Key: "scopes", Value: bson.A{""}}}, wantMsg: MsgTokenInvalid},
+		{name: "owner deleted", pat: bson.D{}, wantMsg: MsgTokenInvalid},
+		{name: "owner without email", pat: bson.D{}, user: bson.D{{Key: "user_id", Value: "user-1"}, {Key: "user_type", Value: "USER"}}, wantMsg: MsgTokenInvalid},
+		{name: "first use", pat: bson.D{}, user: owner, wantUsed: true},
+		{name: "used a moment ago", pat: bson.D{{Key: "last_used_at", Value: now.Add(-10 * time.Second)}}, user: owner},
+		{name: "used a while ago", pat: bson.D{{Key: "last_used_at", Value: now.Add(-time.Hour)}}, user: owner, wantUsed: true},
+	}
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			patCollection, userCollection = mt.Coll, mt.Coll
+			mt.Cleanup(func() { patCollection, userCollection = nil, nil })
+
+			namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+			var responses []bson.D
+			if test.pat == nil {
+				responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch))
+			} else {
+				pat := append(bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "user_id", Value: "user-1"},
+					{Key: "scopes", Value: bson.A{ScopeUsersRead}},
+				}, test.pat...)
+				responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, pat))
+			}
+			if test.user != nil {
+				responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, test.user))
+			} else {
+				responses = append(responses, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch))
+			}
+			responses = append(responses, mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			mt.AddMockResponses(responses...)
+
+			token := PersonalAccessTokenPrefix + "secret"
+			claims, msg := ValidatePersonalAccessToken(token)
+			if msg != test.wantMsg {
+				mt.Fatalf("ValidatePersonalAccessToken message = %q, want %q", msg, test.wantMsg)
+			}
+			if msg == "" && (claims.Uid != "user-1" || claims.Email != "jane@example.com" || claims.Scope != ScopeUsersRead) {
+				mt.Fatalf("claims = %+v, want the owner with the token's scope", claims)
+			}
+
+			used := false
+			for _, event := range mt.GetAllStartedEvents() {
+				switch event.CommandName {
+				case "find":
+					if hash, err := event.Command.LookupErr("filter", "token_hash"); err == nil && hash.StringValue() != HashPersonalAccessToken(token) {
+						mt.Fatalf("token looked up by %v, want its hash", hash)
+					}
+				case "update":
+					used = true
+				}
+			}
+			if used != test.wantUsed {
+				mt.Fatalf("usage recorded = %v, want %v", used, test.wantUsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// EventMessage is the JSON form in which domain events are published
+type EventMessage struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	AggregateID string                 `json:"aggregate_id"`
+	OccurredAt  time.Time              `json:"occurred_at"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+// Publisher delivers domain events to consumers. Publish must only return nil once the
+// event is handed over; the outbox relay retries it otherwise.
+type Publisher interface {
+	Publish(ctx context.Context, message EventMessage) error
+	Close() error
+}
+
+// DiscardPublisher drops every event. It is used when no broker is configured, so
+// events are still relayed to webhooks without personal data ending up in the logs.
+type DiscardPublisher struct{}
+
+// Publish implements Publisher
+func (DiscardPublisher) Publish(ctx context.Context, message EventMessage) error {
+	return nil
+}
+
+// Close implements Publisher
+func (DiscardPublisher) Close() error {
+	return nil
+}
+
+// MemoryPublisher keeps published events in memory, for development and tests
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []EventMessage
+	limit    int
+}
+
+// NewMemoryPublisher returns a publisher keeping at most limit events; 0 keeps all
+func NewMemoryPublisher(limit int) *MemoryPublisher {
+	return &MemoryPublisher{limit: limit}
+}
+
+// Publish implements Publisher
+func (p *MemoryPublisher) Publish(ctx context.Context, message EventMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, message)
+	if p.limit > 0 && len(p.messages) > p.limit {
+		p.messages = p.messages[len(p.messages)-p.limit:]
+	}
+	return nil
+}
+
+// Messages returns a copy of the events published so far
+func (p *MemoryPublisher) Messages() []EventMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]EventMessage(nil), p.messages...)
+}
+
+// Close implements Publisher
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
+
+// StreamPublisher writes each event as one line of JSON (NDJSON) to a writer such as
+// os.Stdout. Events carry personal data, so it is meant for development only.
+type StreamPublisher struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewStreamPublisher returns a publisher writing NDJSON to w
+func NewStreamPublisher(w io.Writer) *StreamPublisher {
+	return &StreamPublisher{encoder: json.NewEncoder(w)}
+}
+
+// Publish implements Publisher
+func (p *StreamPublisher) Publish(ctx context.Context, message EventMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.encoder.Encode(message)
+}
+
+// Close implements Publisher
+func (p *StreamPublisher) Close() error {
+	return nil
+}
+
+// NATSPublisher publishes events to a NATS server on "<prefix>.<event type>". The event
+// id is sent as Nats-Msg-Id so JetStream streams can drop redelivered duplicates.
+type NATSPublisher struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// NewNATSPublisher connects to the NATS server at url
+func NewNATSPublisher(url string, prefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("jwt-mongodb-go-outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, prefix: prefix}, nil
+}
+
+// Publish implements Publisher. It waits until the server has received the message.
+func (p *NATSPublisher) Publish(ctx context.Context, message EventMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(p.prefix + "." + message.Type)
+	msg.Data = data
+	msg.Header.Set(nats.MsgIdHdr, message.ID)
+	msg.Header.Set("Content-Type", "application/json")
+
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close implements Publisher
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNATSPublisher(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	server := natsserver.RunServer(&opts)
+	t.Cleanup(server.Shutdown)
+
+	// A consumer reading every user event, and a stream keeping them
+	conn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	subscription, err := conn.SubscribeSync("users.>")
+	if err != nil {
+		t.Fatalf("SubscribeSync: %v", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatalf("JetStream: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "USERS", Subjects: []string{"users.>"}}); err != nil {
+		t.Fatalf("AddStream: %v", err)
+	}
+
+	publisher, err := NewNATSPublisher(server.ClientURL(), "users")
+	if err != nil {
+		t.Fatalf("NewNATSPublisher: %v", err)
+	}
+	t.Cleanup(func() { publisher.Close() })
+
+	message := EventMessage{
+		ID:          "event-1",
+		Type:        EventUserCreated,
+		AggregateID: "user-1",
+		OccurredAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:        map[string]interface{}{"user_id": "user-1"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The relay publishes an event again when it could not mark it published
+	for range 2 {
+		if err := publisher.Publish(ctx, message); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	received, err := subscription.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("NextMsg: %v", err)
+	}
+	if received.Subject != "users."+EventUserCreated || received.Header.Get(nats.MsgIdHdr) != message.ID {
+		t.Fatalf("received %q with id %q, want users.%s with id %q", received.Subject, received.Header.Get(nats.MsgIdHdr), EventUserCreated, message.ID)
+	}
+	var decoded EventMessage
+	if err := json.Unmarshal(received.Data, &decoded); err != nil || decoded.ID != message.ID || decoded.AggregateID != message.AggregateID {
+		t.Fatalf("received %s, want the event as JSON", received.Data)
+	}
+
+	// The stream drops the redelivered copy by its id
+	info, err := js.StreamInfo("USERS")
+	if err != nil {
+		t.Fatalf("StreamInfo: %v", err)
+	}
+	if info.State.Msgs != 1 {
+		t.Fatalf("stream holds %d messages, want 1", info.State.Msgs)
+	}
+
+	// Without a server the event is not handed over and the relay must retry it
+	server.Shutdown()
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer shortCancel()
+	if err := publisher.Publish(shortCtx, message); err == nil {
+		t.Fatal("Publish succeeded without a server")
+	}
+}
@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// DecodeJSONBody decodes a JSON request body of at most maxBytes into dst. Unlike gin's
+// binding it rejects fields dst does not have and anything after the JSON object, and
+// its errors are fit to show to the client.
+func DecodeJSONBody(c *gin.Context, dst interface{}, maxBytes int64) error {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("request body is required")
+		case errors.As(err, &maxBytesErr):
+			return fmt.Errorf("request body must not be larger than %d bytes", maxBytes)
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("request body is not valid JSON (at byte %d)", syntaxErr.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("request body is not valid JSON")
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return fmt.Errorf("%s must be a %s", typeErr.Field, typeErr.Type)
+		case errors.As(err, &typeErr):
+			return errors.New("request body must be a JSON object")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return errors.New(strings.TrimPrefix(err.Error(), "json: ") + " in request body")
+		default:
+			return err
+		}
+	}
+
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// ValidationErrorMessages describes every failed validation rule of err in terms of the
+// JSON fields, such as "email is not a valid email address"
+func ValidationErrorMessages(err error) []string {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return []string{err.Error()}
+	}
+
+	messages := make([]string, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		field := strings.ToLower(fieldErr.Field())
+		switch fieldErr.Tag() {
+		case "required":
+			messages = append(messages, field+" is required")
+		case "email":
+			messages = append(messages, field+" is not a valid email address")
+		case "min":
+			if fieldErr.Param() == "1" {
+				messages = append(messages, field+" must not be empty")
+			} else {
+				messages = append(messages, field+" must be at least "+fieldErr.Param()+" characters")
+			}
+		case "max":
+			messages = append(messages, field+" must be at most "+fieldErr.Param()+" characters")
+		case "oneof":
+			messages = append(messages, field+" must be one of "+strings.Join(strings.Fields(fieldErr.Param()), ", "))
+		case "eq=ADMIN|eq=USER":
+			messages = append(messages, field+" must be ADMIN or USER")
+		default:
+			messages = append(messages, field+" failed "+fieldErr.Tag())
+		}
+	}
+	return messages
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes that can be granted to tokens
+const (
+	ScopeUsersRead   = "users:read"
+	ScopeUsersWrite  = "users:write"
+	ScopeUsersDelete = "users:delete"
+	ScopeTokensRead  = "tokens:read"
+	ScopeTokensWrite = "tokens:write"
+
+	ScopeUsersImpersonate = "users:impersonate"
+	ScopeAuditRead        = "audit:read"
+	ScopeWebhooksManage   = "webhooks:manage"
+)
+
+// AllScopes lists every scope known to the API
+var AllScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeUsersDelete, ScopeTokensRead, ScopeTokensWrite, ScopeUsersImpersonate, ScopeAuditRead, ScopeWebhooksManage}
+
+// ValidateScopes checks that every requested scope is known
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// Scopes returns the scopes granted by the claims. Tokens issued before the
+// scope claim existed carry no scope and keep full access.
+func (claims *SignedDetails) Scopes() []string {
+	if claims.Scope == "" {
+		return AllScopes
+	}
+	return strings.Fields(claims.Scope)
+}
+
+// NarrowScopes returns the space separated requested scopes if they are all
+// within granted, or granted itself when nothing was requested
+func NarrowScopes(requested string, granted []string) ([]string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return granted, nil
+	}
+
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return nil, fmt.Errorf("scope %q exceeds the granted scopes", scope)
+		}
+	}
+	return scopes, nil
+}
+
+// NarrowTokenScopes returns the scopes requested for a new token if they are all
+// within granted. Unlike NarrowScopes, an empty request is an error rather than
+// everything granted.
+func NarrowTokenScopes(requested []string, granted []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	if err := ValidateScopes(requested); err != nil {
+		return nil, err
+	}
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			return nil, fmt.Errorf("scope %q exceeds the granted scopes", scope)
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(requested))), nil
+}
+
+// HasScopes reports whether every required scope is in granted
+func HasScopes(granted []string, required ...string) bool {
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNarrowTokenScopes(t *testing.T) {
+	granted := []string{ScopeUsersRead, ScopeTokensRead}
+
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "within granted", requested: []string{ScopeTokensRead, ScopeUsersRead, ScopeUsersRead}, want: []string{ScopeTokensRead, ScopeUsersRead}},
+		{name: "nothing requested", requested: nil, wantErr: true},
+		{name: "empty scope", requested: []string{""}, wantErr: true},
+		{name: "several scopes in one entry", requested: []string{ScopeUsersRead + " " + ScopeTokensRead}, wantErr: true},
+		{name: "unknown scope", requested: []string{"users:everything"}, wantErr: true},
+		{name: "beyond granted", requested: []string{ScopeUsersWrite}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scopes, err := NarrowTokenScopes(test.requested, granted)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("NarrowTokenScopes(%q) = %q, want an error", test.requested, scopes)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(scopes, test.want) {
+				t.Fatalf("NarrowTokenScopes(%q) = %q, %v, want %q", test.requested, scopes, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// deriveKey derives a purpose-specific HMAC key from SECRET_KEY so values
+// signed for one flow can never be replayed in another (or parsed as a JWT)
+func deriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SignValue returns payload encoded as "<payload>.<mac>" using a key derived for purpose
+func SignValue(purpose string, payload []byte) string {
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, deriveKey(purpose))
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignedValue checks a value produced by SignValue and returns its payload
+func VerifySignedValue(purpose string, value string) ([]byte, bool) {
+	encoded, sig, found := strings.Cut(value, ".")
+	if !found {
+		return nil, false
+	}
+
+	providedMac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, deriveKey(purpose))
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(providedMac, mac.Sum(nil)) {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	return payload, true
+}
+
+// HashSecret returns the hex SHA-256 of a high-entropy secret for storage and lookup
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomString returns a URL-safe random string built from n random bytes
+func RandomString(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
@@ -2,9 +2,11 @@ package helpers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -22,9 +24,79 @@ type SignedDetails struct {
 	Last_name  string
 	Uid        string
 	User_type  string
+	Typ        string           `json:"typ,omitempty"`
+	Scope      string           `json:"scope,omitempty"`
+	Act        *ActorClaims     `json:"act,omitempty"`
+	Auth_time  *jwt.NumericDate `json:"auth_time,omitempty"`
+	Cnf        *Confirmation    `json:"cnf,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Confirmation binds a token to a DPoP key by its JWK SHA-256 thumbprint (RFC 9449 section 6)
+type Confirmation struct {
+	Jkt string `json:"jkt"`
+}
+
+// ActorClaims identifies the party acting on behalf of the subject (RFC 8693 "act" claim)
+type ActorClaims struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email,omitempty"`
+}
+
+// TokenOption customizes the claims of tokens issued by GenerateAllTokens
+type TokenOption func(claims *SignedDetails)
+
+// WithScopes restricts the issued tokens to the given scopes
+func WithScopes(scopes []string) TokenOption {
+	return func(claims *SignedDetails) {
+		claims.Scope = strings.Join(scopes, " ")
+	}
+}
+
+// WithActor marks the token as issued to actorUid acting as the subject, within the given session
+func WithActor(actorUid string, actorEmail string, sessionId string) TokenOption {
+	return func(claims *SignedDetails) {
+		claims.Act = &ActorClaims{Sub: actorUid, Email: actorEmail}
+		claims.ID = sessionId
+	}
+}
+
+// WithAuthTime records when the user last proved their identity (password, MFA, ...)
+func WithAuthTime(authTime time.Time) TokenOption {
+	return func(claims *SignedDetails) {
+		claims.Auth_time = jwt.NewNumericDate(authTime)
+	}
+}
+
+// WithConfirmation binds the tokens to the DPoP key with the given thumbprint
+func WithConfirmation(jkt string) TokenOption {
+	return func(claims *SignedDetails) {
+		if jkt != "" {
+			claims.Cnf = &Confirmation{Jkt: jkt}
+		}
+	}
+}
+
+// Messages returned by ValidateToken and ValidatePersonalAccessToken, used by
+// middlewares.Authenticate to pick the error code of its challenge
+const (
+	MsgTokenInvalid   = "The token is invalid"
+	MsgTokenMalformed = "The token is malformed"
+	MsgTokenExpired   = "Token is expired"
+	MsgTokenRevoked   = "Token has been revoked"
+)
+
+// Values of the typ claim, which keeps refresh tokens from being used as access tokens.
+// Tokens issued before the claim existed have none.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// Lifetimes of the tokens issued by GenerateAllTokens
+const AccessTokenTTL = time.Hour * 24
+const RefreshTokenTTL = time.Hour * 168
+
 var userCollection *mongo.Collection
 var SECRET_KEY string
 
@@ -38,7 +110,7 @@ func InitializeTokenHelper() {
 }
 
 // GenerateAllTokens generates both access and refresh tokens
-func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string) (signedToken string, signedRefreshToken string, err error) {
+func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string, opts ...TokenOption) (signedToken string, signedRefreshToken string, err error) {
 	// Ensure initialization
 	if SECRET_KEY == "" {
 		return "", "", fmt.Errorf("token helper not initialized - call InitializeTokenHelper() first")
@@ -51,8 +123,9 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 		Last_name:  lastName,
 		Uid:        uid,
 		User_type:  userType,
+		Typ:        TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -65,13 +138,22 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 		Last_name:  lastName,
 		Uid:        uid,
 		User_type:  userType,
+		Typ:        TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 168)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	// Tokens carry every scope unless narrowed by an option
+	for _, claim := range []*SignedDetails{claims, refreshClaims} {
+		claim.Scope = strings.Join(AllScopes, " ")
+		for _, opt := range opts {
+			opt(claim)
+		}
+	}
+
 	// Generate access token
 	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
 	if err != nil {
@@ -86,15 +168,65 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 		return "", "", err
 	}
 
+	// Optionally encrypt the signed tokens to hide their claims
+	if token, err = encryptToken(accessTokenEncrypter, token); err != nil {
+		return "", "", err
+	}
+	if refreshToken, err = encryptToken(refreshTokenEncrypter, refreshToken); err != nil {
+		return "", "", err
+	}
+
 	return token, refreshToken, nil
 }
 
+// GenerateAccessToken generates a single access token valid for ttl, without a refresh token
+func GenerateAccessToken(email string, firstName string, lastName string, userType string, uid string, ttl time.Duration, opts ...TokenOption) (signedToken string, err error) {
+	// Ensure initialization
+	if SECRET_KEY == "" {
+		return "", fmt.Errorf("token helper not initialized - call InitializeTokenHelper() first")
+	}
+
+	claims := &SignedDetails{
+		Email:      email,
+		First_name: firstName,
+		Last_name:  lastName,
+		Uid:        uid,
+		User_type:  userType,
+		Typ:        TokenTypeAccess,
+		Scope:      strings.Join(AllScopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	signedToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+	if err != nil {
+		return "", err
+	}
+
+	// Optionally encrypt the signed token to hide its claims
+	return encryptToken(accessTokenEncrypter, signedToken)
+}
+
 // ValidateToken validates the JWT token and returns claims
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	// Ensure initialization
 	if SECRET_KEY == "" {
 		return nil, "token helper not initialized"
 	}
+
+	// Unwrap encrypted tokens to reach the signed JWT
+	signedToken, encrypted, err := decryptToken(signedToken)
+	if err != nil {
+		msg = MsgTokenInvalid
+		return
+	}
+
 	// Parse the token
 	token, err := jwt.ParseWithClaims(
 		signedToken,
@@ -109,20 +241,35 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	)
 
 	if err != nil {
-		msg = err.Error()
+		msg = MsgTokenInvalid
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) {
+			switch {
+			case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+				msg = MsgTokenMalformed
+			case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+				msg = MsgTokenExpired
+			}
+		}
 		return
 	}
 
 	// Extract claims
 	claims, ok := token.Claims.(*SignedDetails)
 	if !ok {
-		msg = "The token is invalid"
+		msg = MsgTokenInvalid
 		return
 	}
 
 	// Check if token is expired
-	if claims.ExpiresAt.Before(time.Now()) {
-		msg = "Token is expired"
+	if claims.ExpiresAt == nil || claims.ExpiresAt.Before(time.Now()) {
+		msg = MsgTokenExpired
+		return
+	}
+
+	// Once tokens of a type are encrypted, plain ones would expose their claims again
+	if !encrypted && tokenEncrypter(claims.Typ) != nil {
+		msg = MsgTokenInvalid
 		return
 	}
 
@@ -0,0 +1,193 @@
+package helpers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Formats users can be exported in
+const (
+	UserExportCSV    = "csv"
+	UserExportNDJSON = "ndjson"
+)
+
+// Rows read from the database per round trip, and rows written between flushes
+const userExportBatchSize = 1000
+
+// UserExportColumns are the exported fields, in CSV column order
+var UserExportColumns = []string{"user_id", "first_name", "last_name", "email", "phone", "user_type", "status", "created_at", "updated_at", "deleted_at"}
+
+// userExportProjection loads only the exported fields, so passwords and tokens never
+// leave the database
+var userExportProjection = bson.M{
+	"_id":          0,
+	"user_id":      1,
+	"first_name":   1,
+	"last_name":    1,
+	"email":        1,
+	"phone":        1,
+	"user_type":    1,
+	"status":       1,
+	"status_until": 1,
+	"created_at":   1,
+	"updated_at":   1,
+	"deleted_at":   1,
+}
+
+// UserExportRow is one exported user
+type UserExportRow struct {
+	User_id    string     `json:"user_id"`
+	First_name string     `json:"first_name"`
+	Last_name  string     `json:"last_name"`
+	Email      string     `json:"email"`
+	Phone      string     `json:"phone"`
+	User_type  string     `json:"user_type"`
+	Status     string     `json:"status"`
+	Created_at time.Time  `json:"created_at"`
+	Updated_at time.Time  `json:"updated_at"`
+	Deleted_at *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ValidUserExportFormat reports whether users can be exported in format
+func ValidUserExportFormat(format string) bool {
+	return format == UserExportCSV || format == UserExportNDJSON
+}
+
+// UserExportContentType returns the media type of a user export in format
+func UserExportContentType(format string) string {
+	if format == UserExportCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// UserStatusFilter matches the users whose status in force is status, taking expired
+// suspensions into account like EffectiveAccountStatus
+func UserStatusFilter(status string) bson.M {
+	now := time.Now()
+	if status == StatusActive {
+		return bson.M{"$or": []bson.M{
+			{"status": bson.M{"$in": []interface{}{nil, "", StatusActive}}},
+			{"status_until": bson.M{"$lte": now}},
+		}}
+	}
+	return bson.M{
+		"status": status,
+		"$or": []bson.M{
+			{"status_until": nil},
+			{"status_until": bson.M{"$gt": now}},
+		},
+	}
+}
+
+// StreamUsers writes every user matching filter to w in format, reading them through a
+// cursor so memory use does not grow with the number of users. Output is flushed every
+// batch when w supports it. It returns the number of users written.
+func StreamUsers(ctx context.Context, w io.Writer, format string, filter bson.M) (int64, error) {
+	// Ensure initialization
+	if userCollection == nil {
+		return 0, errors.New("database not initialized")
+	}
+
+	opts := options.Find().
+		SetProjection(userExportProjection).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetBatchSize(userExportBatchSize)
+	cursor, err := userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	buffered := bufio.NewWriter(w)
+	var writeRow func(UserExportRow) error
+	if format == UserExportCSV {
+		csvWriter := csv.NewWriter(buffered)
+		if err := csvWriter.Write(UserExportColumns); err != nil {
+			return 0, err
+		}
+		writeRow = func(row UserExportRow) error {
+			var deletedAt string
+			if row.Deleted_at != nil {
+				deletedAt = row.Deleted_at.Format(time.RFC3339)
+			}
+			if err := csvWriter.Write([]string{
+				row.User_id, row.First_name, row.Last_name, row.Email, row.Phone, row.User_type, row.Status,
+				row.Created_at.Format(time.RFC3339), row.Updated_at.Format(time.RFC3339), deletedAt,
+			}); err != nil {
+				return err
+			}
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	} else {
+		encoder := json.NewEncoder(buffered)
+		writeRow = func(row UserExportRow) error {
+			return encoder.Encode(row)
+		}
+	}
+
+	var count int64
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return count, err
+		}
+		if err := writeRow(userExportRow(user)); err != nil {
+			return count, err
+		}
+		count++
+
+		if count%userExportBatchSize == 0 {
+			if err := flushUserExport(buffered, w); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, flushUserExport(buffered, w)
+}
+
+// userExportRow keeps the exported fields of a user
+func userExportRow(user models.User) UserExportRow {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return UserExportRow{
+		User_id:    user.User_id,
+		First_name: value(user.First_name),
+		Last_name:  value(user.Last_name),
+		Email:      value(user.Email),
+		Phone:      value(user.Phone),
+		User_type:  value(user.User_type),
+		Status:     UserAccountStatus(user),
+		Created_at: user.Created_at,
+		Updated_at: user.Updated_at,
+		Deleted_at: user.Deleted_at,
+	}
+}
+
+// flushUserExport pushes buffered rows to w and on to the client when w is a response
+func flushUserExport(buffered *bufio.Writer, w io.Writer) error {
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := w.(interface{ Flush() }); ok {
+		flusher.Flush()
+	}
+	return nil
+}
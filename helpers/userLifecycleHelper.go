@@ -0,0 +1,260 @@
+package helpers
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User lifecycle events that only exist because users are soft deleted
+const (
+	EventUserRestored = "user.restored"
+	EventUserPurged   = "user.purged"
+)
+
+// Collections holding records of a user, by the field naming them, that are removed when
+// the user is purged. Data exports are removed with their bundles. The audit log is kept;
+// its personal data is digested into the hash chain.
+var userOwnedCollections = []struct {
+	name  string
+	field string
+}{
+	{"personal_access_tokens", "user_id"},
+	{"webauthn_credentials", "user_id"},
+	{"webauthn_sessions", "user_id"},
+	{"login_events", "user_id"},
+	{"magic_links", "user_id"},
+	{"impersonation_sessions", "target_id"},
+}
+
+var userRetention = 30 * 24 * time.Hour
+var userPurgeInterval = time.Hour
+var userStateCacheTTL = 30 * time.Second
+var userStateSweepInterval = time.Minute
+
+// userStateCache remembers for a short while whether a user may still use their tokens,
+// so authenticating a request does not always cost a database round trip. The purge job
+// sweeps out expired entries.
+var userStateCache = map[string]userStateEntry{}
+var userStateMutex sync.Mutex
+
+type userStateEntry struct {
+	state   UserState
+	expires time.Time
+}
+
+// UserState is what decides whether the tokens of a user are honoured
+type UserState struct {
+	Exists       bool // false for unknown and deleted users
+	Status       string
+	Status_until *time.Time
+}
+
+// AccountStatus returns the account status in force
+func (s UserState) AccountStatus() string {
+	return EffectiveAccountStatus(s.Status, s.Status_until)
+}
+
+// InitializeUserLifecycleHelper initializes the package variables after DB connection.
+// USER_RETENTION (default 720h) is how long soft-deleted users can be restored before
+// they are purged; erased users are kept. USER_PURGE_INTERVAL (default 1h) is how often
+// the purge job runs and USER_STATE_CACHE_TTL (default 30s) how long other instances may
+// keep honouring the tokens of a user deleted or suspended elsewhere; 0 disables the cache.
+func InitializeUserLifecycleHelper() {
+	if raw := os.Getenv("USER_RETENTION"); raw != "" {
+		retention, err := time.ParseDuration(raw)
+		if err != nil || retention <= 0 {
+			log.Fatal("USER_RETENTION must be a positive duration such as 720h")
+		}
+		userRetention = retention
+	}
+	if raw := os.Getenv("USER_PURGE_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			log.Fatal("USER_PURGE_INTERVAL must be a positive duration such as 1h")
+		}
+		userPurgeInterval = interval
+	}
+	if raw := os.Getenv("USER_STATE_CACHE_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl < 0 {
+			log.Fatal("USER_STATE_CACHE_TTL must be a duration such as 30s")
+		}
+		userStateCacheTTL = ttl
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The purge job looks for users deleted before the retention cut-off
+	_, err := userCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		log.Println("Failed to create user deleted_at index:", err)
+	}
+}
+
+// NotDeleted adds the condition excluding soft-deleted users to a user filter
+func NotDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// UserPurgeAt returns when a user deleted at deletedAt will be purged
+func UserPurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(userRetention)
+}
+
+// GetUserState returns whether the user exists, is not deleted, and their account status
+func GetUserState(ctx context.Context, userId string) (UserState, error) {
+	userStateMutex.Lock()
+	entry, ok := userStateCache[userId]
+	userStateMutex.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.state, nil
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx,
+		NotDeleted(bson.M{"user_id": userId}),
+		options.FindOne().SetProjection(bson.M{"_id": 1, "status": 1, "status_until": 1}),
+	).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return UserState{}, err
+	}
+
+	state := UserState{Exists: err == nil, Status_until: user.Status_until}
+	if user.Status != nil {
+		state.Status = *user.Status
+	}
+
+	if userStateCacheTTL > 0 {
+		// A status that expires must not be cached past its expiry
+		expires := time.Now().Add(userStateCacheTTL)
+		if state.Status_until != nil && state.Status_until.Before(expires) {
+			expires = *state.Status_until
+		}
+		userStateMutex.Lock()
+		userStateCache[userId] = userStateEntry{state: state, expires: expires}
+		userStateMutex.Unlock()
+	}
+	return state, nil
+}
+
+// InvalidateUserState drops the cached state of a user after it changed
+func InvalidateUserState(userId string) {
+	userStateMutex.Lock()
+	delete(userStateCache, userId)
+	userStateMutex.Unlock()
+}
+
+// sweepUserStateCache drops the cached states that expired, so the cache only holds
+// recently seen users
+func sweepUserStateCache() {
+	now := time.Now()
+	userStateMutex.Lock()
+	defer userStateMutex.Unlock()
+
+	maps.DeleteFunc(userStateCache, func(userId string, entry userStateEntry) bool {
+		return !now.Before(entry.expires)
+	})
+}
+
+// StartUserPurgeJob permanently removes users whose retention period has passed,
+// checking every USER_PURGE_INTERVAL until ctx is done. Meanwhile it sweeps the
+// user state cache every minute.
+func StartUserPurgeJob(ctx context.Context) {
+	// Ensure initialization
+	if userCollection == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(userPurgeInterval)
+		defer ticker.Stop()
+
+		sweep := time.NewTicker(userStateSweepInterval)
+		defer sweep.Stop()
+
+		purgeDeletedUsers(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purgeDeletedUsers(ctx)
+			case <-sweep.C:
+				sweepUserStateCache()
+			}
+		}
+	}()
+}
+
+// purgeDeletedUsers purges every user deleted before the retention cut-off
+func purgeDeletedUsers(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-userRetention)
+
+	cursor, err := userCollection.Find(ctx,
+		bson.M{"deleted_at": bson.M{"$lte": cutoff}, "erased_at": nil},
+		options.Find().SetProjection(bson.M{"user_id": 1}),
+	)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println("Failed to find users to purge:", err)
+		}
+		return
+	}
+
+	var users []struct {
+		User_id string
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		log.Println("Failed to find users to purge:", err)
+		return
+	}
+
+	for _, user := range users {
+		if err := purgeUser(ctx, user.User_id, cutoff); err != nil {
+			log.Println("Failed to purge user "+user.User_id+":", err)
+		}
+	}
+}
+
+// purgeUser deletes a user and the records they own, unless they were restored meanwhile
+func purgeUser(ctx context.Context, userId string, cutoff time.Time) error {
+	purged := false
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := userCollection.DeleteOne(ctx, bson.M{"user_id": userId, "deleted_at": bson.M{"$lte": cutoff}, "erased_at": nil})
+		if err != nil || result.DeletedCount == 0 {
+			return err
+		}
+		for _, owned := range userOwnedCollections {
+			if _, err := database.GetCollection(owned.name).DeleteMany(ctx, bson.M{owned.field: userId}); err != nil {
+				return err
+			}
+		}
+		if _, err := deleteDataExports(ctx, bson.M{"user_id": userId}); err != nil {
+			return err
+		}
+		purged = true
+		return WriteOutboxEvent(ctx, EventUserPurged, userId, map[string]interface{}{"user_id": userId})
+	})
+	if err != nil || !purged {
+		return err
+	}
+
+	InvalidateUserState(userId)
+	AuditSystem(ctx, AuditRecord{Action: AuditUserPurge, TargetType: "user", TargetID: userId, Reason: "retention period expired"})
+	return nil
+}
@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSweepUserStateCache(t *testing.T) {
+	userStateCache = map[string]userStateEntry{
+		"expired": {expires: time.Now().Add(-time.Second)},
+		"fresh":   {expires: time.Now().Add(time.Minute)},
+	}
+	t.Cleanup(func() { userStateCache = map[string]userStateEntry{} })
+
+	sweepUserStateCache()
+
+	if _, ok := userStateCache["expired"]; ok {
+		t.Fatal("expired state was kept")
+	}
+	if _, ok := userStateCache["fresh"]; !ok {
+		t.Fatal("fresh state was swept")
+	}
+}
+
+func TestPurgeUserRemovesOwnedRecords(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("deleted user", func(mt *mtest.T) {
+		previous := database.DB
+		database.DB = database.DBInstance{Client: mt.Client, DB: mt.DB}
+		userCollection, outboxCollection, dataExportCollection = mt.Coll, mt.Coll, mt.DB.Collection("data_exports")
+		bucket, err := gridfs.NewBucket(mt.DB)
+		if err != nil {
+			mt.Fatalf("NewBucket: %v", err)
+		}
+		dataExportBucket = bucket
+		mt.Cleanup(func() {
+			database.DB = previous
+			userCollection, outboxCollection, dataExportCollection, dataExportBucket = nil, nil, nil, nil
+		})
+
+		deleted := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+		responses := []bson.D{
+			// Transaction support is detected on first use; the mock is a standalone server
+			mtest.CreateSuccessResponse(),
+			deleted,
+		}
+		for range userOwnedCollections {
+			responses = append(responses, deleted)
+		}
+		namespace := mt.DB.Name() + ".data_exports"
+		responses = append(responses,
+			mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: primitive.NewObjectID()},
+				{Key: "user_id", Value: "user-1"},
+				{Key: "file_id", Value: primitive.NewObjectID()},
+			}),
+			deleted, // bundle file
+			deleted, // bundle chunks
+			deleted, // export
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		mt.AddMockResponses(responses...)
+
+		if err := purgeUser(context.Background(), "user-1", time.Now()); err != nil {
+			mt.Fatalf("purgeUser: %v", err)
+		}
+
+		deletes := map[string]bson.Raw{}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "delete" {
+				deletes[event.Command.Lookup("delete").StringValue()] = event.Command.Lookup("deletes", "0", "q").Document()
+			}
+		}
+		if filter, ok := deletes["impersonation_sessions"]; !ok || filter.Lookup("target_id").StringValue() != "user-1" {
+			mt.Fatalf("impersonation sessions were not purged by target: %v", filter)
+		}
+		for _, collection := range []string{"data_exports", "fs.files", "fs.chunks"} {
+			if _, ok := deletes[collection]; !ok {
+				mt.Fatalf("%s were not purged", collection)
+			}
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page sizes of the user list
+const (
+	UserPageDefaultSize = 10
+	UserPageMaxSize     = 100
+)
+
+// ErrInvalidPageCursor is returned for a page cursor that was not issued by ListUsers
+var ErrInvalidPageCursor = errors.New("cursor is invalid")
+
+// UserPage is one page of the user list. The cursors continue the list after the last
+// user or before the first one and are empty at either end.
+type UserPage struct {
+	Users       []models.UserRecord
+	Total       int64
+	Next_cursor string
+	Prev_cursor string
+}
+
+// UserSortFields are the fields the user list can be sorted by
+var UserSortFields = []string{"created_at", "updated_at", "email", "first_name", "last_name"}
+
+// UserSort orders the user list by Field, ascending for Order 1 and descending for -1.
+// Users with the same value are ordered by _id.
+type UserSort struct {
+	Field string
+	Order int
+}
+
+// DefaultUserSort lists the oldest users first
+var DefaultUserSort = UserSort{Field: "created_at", Order: 1}
+
+// userPageCursorPurpose is the signing purpose of page cursors
+const userPageCursorPurpose = "user-page-cursor"
+
+// userPageCursor is the position a page cursor points at: the sort value and _id of the
+// user next to the page. It is BSON so dates stay dates, and signed so clients cannot
+// put anything else into the query.
+type userPageCursor struct {
+	Sort   string             `bson:"s"`
+	Order  int                `bson:"o"`
+	Value  interface{}        `bson:"v"`
+	ID     primitive.ObjectID `bson:"i"`
+	Before bool               `bson:"b,omitempty"`
+}
+
+// InitializeUserListHelper creates the indexes the user list is filtered, sorted and
+// searched through
+func InitializeUserListHelper() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Every sort field is paired with _id, which breaks ties between pages
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_type", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "phone", Value: 1}}},
+		{Keys: bson.D{
+			{Key: "first_name", Value: "text"},
+			{Key: "last_name", Value: "text"},
+			{Key: "email", Value: "text"},
+			{Key: "phone", Value: "text"},
+		}, Options: options.Index().SetName("user_search")},
+	}
+	for _, field := range UserSortFields {
+		indexes = append(indexes, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}}})
+	}
+	if _, err := userCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Println("Failed to create user list indexes:", err)
+	}
+}
+
+// ListUsers returns a page of at most size users matching filter in the given order.
+// Without a cursor the page is found by number, skipping the pages before it; with a
+// cursor from an earlier page the list continues from it, which stays fast however deep
+// the page is. A cursor only continues the order it was issued for.
+func ListUsers(ctx context.Context, filter bson.M, sort UserSort, size int, page int, cursor string) (*UserPage, error) {
+	var position *userPageCursor
+	if cursor != "" {
+		var err error
+		position, err = decodeUserPageCursor(cursor)
+		if err != nil || position.Sort != sort.Field || position.Order != sort.Order {
+			return nil, ErrInvalidPageCursor
+		}
+	}
+
+	total, err := userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetProjection(UserRecordProjection).SetLimit(int64(size + 1))
+	query := filter
+	order := sort.Order
+	if position != nil {
+		// Pages before the cursor are read backwards and turned around
+		if position.Before {
+			order = -order
+		}
+		query = bson.M{"$and": []bson.M{filter, userPageQuery(sort.Field, position.Value, position.ID, order)}}
+	} else {
+		opts.SetSkip(int64((page - 1) * size))
+	}
+	opts.SetSort(bson.D{{Key: sort.Field, Value: order}, {Key: "_id", Value: order}})
+
+	found, err := userCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	users := []models.User{}
+	if err := found.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	// One user more than the page holds tells whether the list goes on
+	more := len(users) > size
+	if more {
+		users = users[:size]
+	}
+	hasNext, hasPrev := more, page > 1
+	if position != nil {
+		if position.Before {
+			slices.Reverse(users)
+			hasNext, hasPrev = true, more
+		} else {
+			hasNext, hasPrev = more, true
+		}
+	}
+
+	result := &UserPage{Users: NewUserRecords(users), Total: total}
+	if len(users) > 0 {
+		if hasNext {
+			last := users[len(users)-1]
+			result.Next_cursor = encodeUserPageCursor(userPageCursor{Sort: sort.Field, Order: sort.Order, Value: userSortValue(last, sort.Field), ID: last.ID})
+		}
+		if hasPrev {
+			first := users[0]
+			result.Prev_cursor = encodeUserPageCursor(userPageCursor{Sort: sort.Field, Order: sort.Order, Value: userSortValue(first, sort.Field), ID: first.ID, Before: true})
+		}
+	}
+	return result, nil
+}
+
+// userPageQuery matches the users after a position in the given order. Users without a
+// value sort before every value, so they come first ascending and last descending.
+func userPageQuery(field string, value interface{}, id primitive.ObjectID, order int) bson.M {
+	operator := "$gt"
+	if order < 0 {
+		operator = "$lt"
+	}
+	after := []bson.M{{field: value, "_id": bson.M{operator: id}}}
+
+	switch {
+	case value == nil && order > 0:
+		after = append(after, bson.M{field: bson.M{"$ne": nil}})
+	case value != nil && order > 0:
+		after = append(after, bson.M{field: bson.M{operator: value}})
+	case value != nil && order < 0:
+		after = append(after, bson.M{field: bson.M{operator: value}}, bson.M{field: nil})
+	}
+	return bson.M{"$or": after}
+}
+
+// userSortValue returns the value of a sort field of a user
+func userSortValue(user models.User, field string) interface{} {
+	var value *string
+	switch field {
+	case "created_at":
+		return user.Created_at
+	case "updated_at":
+		return user.Updated_at
+	case "email":
+		value = user.Email
+	case "first_name":
+		value = user.First_name
+	case "last_name":
+		value = user.Last_name
+	}
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// encodeUserPageCursor turns a position into an opaque cursor
+func encodeUserPageCursor(position userPageCursor) string {
+	data, _ := bson.Marshal(position)
+	return SignValue(userPageCursorPurpose, data)
+}
+
+// decodeUserPageCursor reads the position of a cursor made by encodeUserPageCursor. The
+// value must have the type of the sort field: a date, or a string or nothing for names.
+func decodeUserPageCursor(cursor string) (*userPageCursor, error) {
+	data, ok := VerifySignedValue(userPageCursorPurpose, cursor)
+	if !ok {
+		return nil, ErrInvalidPageCursor
+	}
+	var position userPageCursor
+	if err := bson.Unmarshal(data, &position); err != nil || position.ID.IsZero() {
+		return nil, ErrInvalidPageCursor
+	}
+
+	switch position.Value.(type) {
+	case primitive.DateTime:
+		ok = position.Sort == "created_at" || position.Sort == "updated_at"
+	case string, nil:
+		ok = position.Sort == "email" || position.Sort == "first_name" || position.Sort == "last_name"
+	default:
+		ok = false
+	}
+	if !ok {
+		return nil, ErrInvalidPageCursor
+	}
+	return &position, nil
+}
@@ -0,0 +1,214 @@
+package helpers
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDecodeUserPageCursorRejectsForgedCursors(t *testing.T) {
+	SECRET_KEY = "test-secret"
+	id := primitive.NewObjectID()
+	signed := func(position interface{}) string {
+		data, _ := bson.Marshal(position)
+		return SignValue(userPageCursorPurpose, data)
+	}
+	valid := encodeUserPageCursor(userPageCursor{Sort: "last_name", Order: 1, Value: "smith", ID: id})
+	unsigned, _ := bson.Marshal(userPageCursor{Sort: "last_name", Order: 1, Value: "smith", ID: id})
+
+	tests := []struct {
+		name   string
+		cursor string
+		ok     bool
+	}{
+		{name: "issued", cursor: valid, ok: true},
+		{name: "missing value", cursor: encodeUserPageCursor(userPageCursor{Sort: "last_name", Order: 1, ID: id}), ok: true},
+		{name: "date", cursor: encodeUserPageCursor(userPageCursor{Sort: "created_at", Order: 1, Value: time.Now(), ID: id}), ok: true},
+		{name: "unsigned", cursor: base64.RawURLEncoding.EncodeToString(unsigned)},
+		{name: "other signature", cursor: valid[:len(valid)-2] + "AA"},
+		{name: "operator document", cursor: signed(bson.M{"s": "last_name", "o": 1, "v": bson.M{"$ne": nil}, "i": id})},
+		{name: "date for a name", cursor: signed(bson.M{"s": "last_name", "o": 1, "v": time.Now(), "i": id})},
+		{name: "name for a date", cursor: signed(bson.M{"s": "created_at", "o": 1, "v": "2026", "i": id})},
+		{name: "unknown field", cursor: signed(bson.M{"s": "password", "o": 1, "v": "x", "i": id})},
+		{name: "no id", cursor: signed(bson.M{"s": "last_name", "o": 1, "v": "smith"})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeUserPageCursor(test.cursor)
+			if (err == nil) != test.ok {
+				t.Fatalf("decodeUserPageCursor error = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
+
+// pagedUser is a user as the page query sees it: a last name that may be missing
+type pagedUser struct {
+	id   primitive.ObjectID
+	name interface{}
+}
+
+// matchesPageQuery evaluates a query built by userPageQuery the way MongoDB does: null
+// matches a missing value, and $gt and $lt only compare values of the same type
+func matchesPageQuery(user pagedUser, query bson.M) bool {
+	for _, clause := range query["$or"].([]bson.M) {
+		matched := true
+		for key, condition := range clause {
+			value := user.name
+			if key == "_id" {
+				value = user.id
+			}
+			if !matchesCondition(value, condition) {
+				matched = false
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesCondition(value interface{}, condition interface{}) bool {
+	operators, ok := condition.(bson.M)
+	if !ok {
+		return value == condition
+	}
+	for operator, operand := range operators {
+		switch operator {
+		case "$ne":
+			return value != operand
+		case "$gt", "$lt":
+			c, comparable := compareValues(value, operand)
+			return comparable && (operator == "$gt" && c > 0 || operator == "$lt" && c < 0)
+		}
+	}
+	return false
+}
+
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return cmp.Compare(a, b), ok
+	case primitive.ObjectID:
+		b, ok := b.(primitive.ObjectID)
+		return cmp.Compare(a.Hex(), b.Hex()), ok
+	}
+	return 0, false
+}
+
+// sortPagedUsers orders users like the user list: missing names first, ties by _id
+func sortPagedUsers(users []pagedUser, order int) []pagedUser {
+	sorted := slices.Clone(users)
+	slices.SortFunc(sorted, func(a, b pagedUser) int {
+		c := 0
+		switch {
+		case a.name == nil && b.name != nil:
+			c = -1
+		case a.name != nil && b.name == nil:
+			c = 1
+		case a.name != nil:
+			c = cmp.Compare(a.name.(string), b.name.(string))
+		}
+		if c == 0 {
+			c = cmp.Compare(a.id.Hex(), b.id.Hex())
+		}
+		return c * order
+	})
+	return sorted
+}
+
+func TestUserPageQueryAcrossTiesAndMissingValues(t *testing.T) {
+	var users []pagedUser
+	for _, name := range []interface{}{"smith", nil, "jones", "smith", nil, "adams", "smith", nil} {
+		users = append(users, pagedUser{id: primitive.NewObjectID(), name: name})
+	}
+
+	for _, order := range []int{1, -1} {
+		sorted := sortPagedUsers(users, order)
+		for i, position := range sorted {
+			query := userPageQuery("last_name", position.name, position.id, order)
+
+			var after []pagedUser
+			for _, user := range users {
+				if matchesPageQuery(user, query) {
+					after = append(after, user)
+				}
+			}
+			// The next page continues right after the position, and a previous page is
+			// the same query read in the opposite order
+			if got, want := sortPagedUsers(after, order), sorted[i+1:]; !slices.Equal(got, want) {
+				t.Fatalf("order %d after %v: matched %v, want %v", order, position, got, want)
+			}
+		}
+	}
+}
+
+func TestListUsersPagesWithCursors(t *testing.T) {
+	SECRET_KEY = "test-secret"
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("next and previous", func(mt *mtest.T) {
+		userCollection = mt.Coll
+		mt.Cleanup(func() { userCollection = nil })
+
+		namespace := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		count := mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(5)}})
+		ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+		sort := UserSort{Field: "last_name", Order: 1}
+
+		// The page ends on a user without a last name
+		mt.AddMockResponses(count, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: ids[0]}},
+			bson.D{{Key: "_id", Value: ids[1]}},
+			bson.D{{Key: "_id", Value: ids[2]}, {Key: "last_name", Value: "smith"}},
+		))
+		first, err := ListUsers(context.Background(), bson.M{}, sort, 2, 1, "")
+		if err != nil {
+			mt.Fatalf("ListUsers: %v", err)
+		}
+		if first.Next_cursor == "" || first.Prev_cursor != "" {
+			mt.Fatalf("first page cursors = %q, %q, want only a next cursor", first.Next_cursor, first.Prev_cursor)
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(count, mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: ids[2]}, {Key: "last_name", Value: "smith"}},
+		))
+		second, err := ListUsers(context.Background(), bson.M{}, sort, 2, 1, first.Next_cursor)
+		if err != nil {
+			mt.Fatalf("ListUsers with the next cursor: %v", err)
+		}
+		if second.Next_cursor != "" || second.Prev_cursor == "" {
+			mt.Fatalf("last page cursors = %q, %q, want only a previous cursor", second.Next_cursor, second.Prev_cursor)
+		}
+
+		var find bson.Raw
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "find" {
+				find = event.Command
+			}
+		}
+		clause := find.Lookup("filter", "$and", "1", "$or", "0").Document()
+		if clause.Lookup("last_name").Type != bson.TypeNull || clause.Lookup("_id", "$gt").ObjectID() != ids[1] {
+			mt.Fatalf("next page continues after %v, want the user without a last name", clause)
+		}
+
+		previous, err := decodeUserPageCursor(second.Prev_cursor)
+		if err != nil || !previous.Before || previous.Value != "smith" || previous.ID != ids[2] {
+			mt.Fatalf("previous cursor = %+v, %v, want before the first user of the page", previous, err)
+		}
+
+		// A cursor only continues the order it was issued for
+		if _, err := ListUsers(context.Background(), bson.M{}, UserSort{Field: "last_name", Order: -1}, 2, 1, first.Next_cursor); err != ErrInvalidPageCursor {
+			mt.Fatalf("ListUsers with a cursor of another order = %v, want %v", err, ErrInvalidPageCursor)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"maps"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UserProfileProjection loads the fields of a UserProfile, so passwords and tokens
+// stay in the database
+var UserProfileProjection = bson.M{
+	"user_id":                 1,
+	"first_name":              1,
+	"last_name":               1,
+	"email":                   1,
+	"phone":                   1,
+	"user_type":               1,
+	"status":                  1,
+	"status_until":            1,
+	"identities":              1,
+	"password_reset_required": 1,
+	"created_at":              1,
+	"updated_at":              1,
+}
+
+// UserRecordProjection loads the fields of a UserRecord
+var UserRecordProjection = userRecordProjection()
+
+func userRecordProjection() bson.M {
+	projection := maps.Clone(UserProfileProjection)
+	for _, field := range []string{"status_reason", "status_changed_at", "status_changed_by", "deleted_at", "deleted_by", "erased_at"} {
+		projection[field] = 1
+	}
+	return projection
+}
+
+// NewUserProfile maps a user to the view returned to the user themselves
+func NewUserProfile(user models.User) models.UserProfile {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return models.UserProfile{
+		User_id:                 user.User_id,
+		First_name:              value(user.First_name),
+		Last_name:               value(user.Last_name),
+		Email:                   value(user.Email),
+		Phone:                   value(user.Phone),
+		User_type:               value(user.User_type),
+		Status:                  UserAccountStatus(user),
+		Identities:              user.Identities,
+		Password_reset_required: user.Password_reset_required,
+		Created_at:              user.Created_at,
+		Updated_at:              user.Updated_at,
+	}
+}
+
+// NewUserRecord maps a user to the admin view
+func NewUserRecord(user models.User) models.UserRecord {
+	return models.UserRecord{
+		UserProfile:       NewUserProfile(user),
+		Status_reason:     user.Status_reason,
+		Status_until:      user.Status_until,
+		Status_changed_at: user.Status_changed_at,
+		Status_changed_by: user.Status_changed_by,
+		Deleted_at:        user.Deleted_at,
+		Deleted_by:        user.Deleted_by,
+		Erased_at:         user.Erased_at,
+	}
+}
+
+// NewUserRecords maps users to the admin view
+func NewUserRecords(users []models.User) []models.UserRecord {
+	records := make([]models.UserRecord, 0, len(users))
+	for _, user := range users {
+		records = append(records, NewUserRecord(user))
+	}
+	return records
+}
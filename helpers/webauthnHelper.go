@@ -0,0 +1,326 @@
+package helpers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Purposes of a WebAuthn ceremony; a session can only be finished for the purpose it was begun with
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+	WebAuthnSecondFactor = "second_factor"
+)
+
+// How long a client has to answer a WebAuthn challenge
+const webAuthnSessionTTL = 5 * time.Minute
+
+// WebAuthn is the relying party configuration, nil when passkeys are not enabled
+var WebAuthn *webauthn.WebAuthn
+
+// WebAuthnRequireSecondFactor makes password logins of users with a passkey finish with an assertion
+var WebAuthnRequireSecondFactor bool
+
+var webAuthnCredentialCollection *mongo.Collection
+var webAuthnSessionCollection *mongo.Collection
+
+// InitializeWebAuthnHelper configures the WebAuthn relying party. Passkeys are enabled by
+// setting WEBAUTHN_RP_ID (the registrable domain, e.g. example.com) and WEBAUTHN_RP_ORIGINS
+// (comma separated origins such as https://app.example.com). WEBAUTHN_RP_NAME is shown by
+// authenticators, WEBAUTHN_ATTESTATION selects the attestation conveyance preference
+// ("none" by default) and WEBAUTHN_SECOND_FACTOR=false lets users with a passkey log in
+// with their password alone.
+func InitializeWebAuthnHelper() {
+	// Stored passkeys are exported and erased with the rest of a user's data, even after
+	// passkeys have been turned off
+	webAuthnCredentialCollection = database.GetCollection("webauthn_credentials")
+	webAuthnSessionCollection = database.GetCollection("webauthn_sessions")
+
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		return
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		log.Fatal("WEBAUTHN_RP_ORIGINS environment variable not set")
+	}
+
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = "JWT Authentication API"
+	}
+
+	attestation := protocol.ConveyancePreference(os.Getenv("WEBAUTHN_ATTESTATION"))
+	switch attestation {
+	case "":
+		attestation = protocol.PreferNoAttestation
+	case protocol.PreferNoAttestation, protocol.PreferIndirectAttestation, protocol.PreferDirectAttestation, protocol.PreferEnterpriseAttestation:
+	default:
+		log.Fatal("WEBAUTHN_ATTESTATION must be one of none, indirect, direct or enterprise")
+	}
+
+	var err error
+	WebAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:                  rpID,
+		RPDisplayName:         rpName,
+		RPOrigins:             origins,
+		AttestationPreference: attestation,
+	})
+	if err != nil {
+		log.Fatal("Invalid WebAuthn configuration: ", err)
+	}
+	WebAuthnRequireSecondFactor = os.Getenv("WEBAUTHN_SECOND_FACTOR") != "false"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Credentials are looked up by id on every assertion
+	_, err = webAuthnCredentialCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "credential_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("Failed to create WebAuthn credential index:", err)
+	}
+
+	// Unfinished ceremonies are removed by MongoDB once they expire
+	_, err = webAuthnSessionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create WebAuthn session index:", err)
+	}
+}
+
+// WebAuthnUser adapts a user and their registered credentials to webauthn.User
+type WebAuthnUser struct {
+	User        models.User
+	Credentials []models.WebAuthnCredential
+}
+
+// WebAuthnID returns the user handle stored by authenticators
+func (u *WebAuthnUser) WebAuthnID() []byte {
+	return []byte(u.User.User_id)
+}
+
+// WebAuthnName returns the account name shown by authenticators
+func (u *WebAuthnUser) WebAuthnName() string {
+	if u.User.Email == nil {
+		return u.User.User_id
+	}
+	return *u.User.Email
+}
+
+// WebAuthnDisplayName returns the human readable name shown by authenticators
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	var names []string
+	if u.User.First_name != nil {
+		names = append(names, *u.User.First_name)
+	}
+	if u.User.Last_name != nil {
+		names = append(names, *u.User.Last_name)
+	}
+	if len(names) == 0 {
+		return u.WebAuthnName()
+	}
+	return strings.Join(names, " ")
+}
+
+// WebAuthnCredentials returns the user's credentials in the form used by the library
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+	for _, stored := range u.Credentials {
+		id, err := base64.RawURLEncoding.DecodeString(stored.Credential_id)
+		if err != nil {
+			continue
+		}
+
+		transports := make([]protocol.AuthenticatorTransport, 0, len(stored.Transports))
+		for _, transport := range stored.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       stored.Public_key,
+			AttestationType: stored.Attestation_type,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: stored.Backup_eligible,
+				BackupState:    stored.Backup_state,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    stored.Aaguid,
+				SignCount: stored.Sign_count,
+			},
+		})
+	}
+	return credentials
+}
+
+// CredentialDescriptors lists the user's credentials for allow and exclude lists
+func (u *WebAuthnUser) CredentialDescriptors() []protocol.CredentialDescriptor {
+	credentials := u.WebAuthnCredentials()
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, credential.Descriptor())
+	}
+	return descriptors
+}
+
+// FindWebAuthnUser loads a user and their registered credentials
+func FindWebAuthnUser(ctx context.Context, userId string) (*WebAuthnUser, error) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, NotDeleted(bson.M{"user_id": userId})).Decode(&user); err != nil {
+		return nil, err
+	}
+	return LoadWebAuthnUser(ctx, user)
+}
+
+// LoadWebAuthnUser loads the registered credentials of a user
+func LoadWebAuthnUser(ctx context.Context, user models.User) (*WebAuthnUser, error) {
+	// Ensure initialization
+	if webAuthnCredentialCollection == nil {
+		return nil, errors.New("WebAuthn is not enabled")
+	}
+
+	cursor, err := webAuthnCredentialCollection.Find(ctx, bson.M{"user_id": user.User_id})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []models.WebAuthnCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+	return &WebAuthnUser{User: user, Credentials: credentials}, nil
+}
+
+// SaveWebAuthnSession stores the challenge of a ceremony and returns the id the client finishes it with.
+// A second factor keeps the method of the first one, so the login is recorded as both.
+func SaveWebAuthnSession(ctx context.Context, userId string, purpose string, method string, scope string, data *webauthn.SessionData) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	sessionId, err := RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	session := models.WebAuthnSession{
+		ID:         primitive.NewObjectID(),
+		Session_id: sessionId,
+		User_id:    userId,
+		Purpose:    purpose,
+		Method:     method,
+		Data:       encoded,
+		Scope:      scope,
+		Expires_at: time.Now().UTC().Add(webAuthnSessionTTL),
+	}
+	if _, err := webAuthnSessionCollection.InsertOne(ctx, session); err != nil {
+		return "", err
+	}
+	return sessionId, nil
+}
+
+// ConsumeWebAuthnSession removes a pending ceremony so its challenge can only be answered once
+func ConsumeWebAuthnSession(ctx context.Context, sessionId string, purposes ...string) (*models.WebAuthnSession, *webauthn.SessionData, error) {
+	var session models.WebAuthnSession
+	err := webAuthnSessionCollection.FindOneAndDelete(ctx, bson.M{
+		"session_id": sessionId,
+		"purpose":    bson.M{"$in": purposes},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err != nil {
+		return nil, nil, errors.New("the WebAuthn session is invalid or has expired")
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal(session.Data, &data); err != nil {
+		return nil, nil, err
+	}
+	return &session, &data, nil
+}
+
+// SaveWebAuthnCredential stores a newly registered credential for a user
+func SaveWebAuthnCredential(ctx context.Context, userId string, name string, credential *webauthn.Credential) (*models.WebAuthnCredential, error) {
+	stored := NewWebAuthnCredential(userId, name, credential)
+	if _, err := webAuthnCredentialCollection.InsertOne(ctx, stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// NewWebAuthnCredential turns a credential verified by the library into the stored form
+func NewWebAuthnCredential(userId string, name string, credential *webauthn.Credential) models.WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return models.WebAuthnCredential{
+		ID:               primitive.NewObjectID(),
+		Credential_id:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		User_id:          userId,
+		Name:             name,
+		Public_key:       credential.PublicKey,
+		Attestation_type: credential.AttestationType,
+		Transports:       transports,
+		Aaguid:           credential.Authenticator.AAGUID,
+		Sign_count:       credential.Authenticator.SignCount,
+		Backup_eligible:  credential.Flags.BackupEligible,
+		Backup_state:     credential.Flags.BackupState,
+		Created_at:       time.Now().UTC(),
+	}
+}
+
+// RecordWebAuthnAssertion stores the new sign count of a credential after a successful
+// assertion. A counter that did not increase points to a cloned authenticator and is rejected.
+func RecordWebAuthnAssertion(ctx context.Context, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return errors.New("the authenticator may have been cloned")
+	}
+
+	_, err := webAuthnCredentialCollection.UpdateOne(ctx,
+		bson.M{"credential_id": base64.RawURLEncoding.EncodeToString(credential.ID)},
+		bson.M{"$set": bson.M{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now().UTC(),
+		}},
+	)
+	return err
+}
+
+// DeleteWebAuthnCredential removes a credential of a user and reports whether it existed
+func DeleteWebAuthnCredential(ctx context.Context, userId string, credentialId string) (bool, error) {
+	result, err := webAuthnCredentialCollection.DeleteOne(ctx, bson.M{"user_id": userId, "credential_id": credentialId})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
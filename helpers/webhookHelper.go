@@ -0,0 +1,340 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kaa-dan/JWT-MongoDb-Go/database"
+	"github.com/kaa-dan/JWT-MongoDb-Go/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User lifecycle events that webhooks can subscribe to
+const (
+	EventUserCreated      = "user.created"
+	EventUserUpdated      = "user.updated"
+	EventUserEmailChanged = "user.email_changed"
+	EventUserDeleted      = "user.deleted"
+)
+
+// WebhookEvents lists every event type a webhook can subscribe to; "*" subscribes to all
+var WebhookEvents = []string{EventUserCreated, EventUserUpdated, EventUserEmailChanged, EventUserDeleted, EventUserRestored, EventUserPurged, EventUserErased, EventUserSuspended, EventUserReinstated}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Headers sent with every delivery
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// How long a worker owns a delivery it is attempting before others may retry it
+const webhookLease = time.Minute
+
+// Retry delays grow from webhookRetryBase by doubling up to webhookRetryMax
+const webhookRetryBase = 30 * time.Second
+const webhookRetryMax = 6 * time.Hour
+
+var webhookCollection *mongo.Collection
+var webhookDeliveryCollection *mongo.Collection
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+var webhookMaxAttempts = 8
+var webhookPollInterval = 5 * time.Second
+
+// WebhookEvent is the JSON body delivered to webhook endpoints
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// InitializeWebhookHelper initializes the package variables after DB connection.
+// WEBHOOK_MAX_ATTEMPTS (default 8) bounds retries, WEBHOOK_TIMEOUT (default 10s) is the
+// per-attempt HTTP timeout and WEBHOOK_POLL_INTERVAL (default 5s) how often the queue is polled.
+func InitializeWebhookHelper() {
+	webhookCollection = database.GetCollection("webhooks")
+	webhookDeliveryCollection = database.GetCollection("webhook_deliveries")
+
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			log.Fatal("WEBHOOK_MAX_ATTEMPTS must be a positive number")
+		}
+		webhookMaxAttempts = attempts
+	}
+	if raw := os.Getenv("WEBHOOK_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			log.Fatal("WEBHOOK_TIMEOUT must be a positive duration such as 10s")
+		}
+		webhookClient.Timeout = timeout
+	}
+	if raw := os.Getenv("WEBHOOK_POLL_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			log.Fatal("WEBHOOK_POLL_INTERVAL must be a positive duration such as 5s")
+		}
+		webhookPollInterval = interval
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The worker picks due deliveries; the delivery log is read per webhook. An event
+	// is delivered to a webhook once, however often the outbox relays it.
+	_, err := webhookDeliveryCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		log.Println("Failed to create webhook delivery indexes:", err)
+	}
+}
+
+// UserEventData is the data sent with user lifecycle events
+func UserEventData(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":    user.User_id,
+		"email":      user.Email,
+		"first_name": user.First_name,
+		"last_name":  user.Last_name,
+		"phone":      user.Phone,
+		"user_type":  user.User_type,
+		"created_at": user.Created_at,
+	}
+}
+
+// ValidateWebhookEvents checks that every subscribed event type is known
+func ValidateWebhookEvents(events []string) error {
+	for _, event := range events {
+		if event != "*" && !slices.Contains(WebhookEvents, event) {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	return nil
+}
+
+// queueWebhookDeliveries queues a delivery of an outbox event for every active webhook
+// subscribed to its type. The outbox relay calls it for every committed event, so webhooks
+// are told about exactly the changes that were made. A relayed event can be relayed again,
+// which finds its deliveries already queued.
+func queueWebhookDeliveries(ctx context.Context, outboxEvent models.OutboxEvent) error {
+	// Ensure initialization
+	if webhookCollection == nil || !slices.Contains(WebhookEvents, outboxEvent.Type) {
+		return nil
+	}
+
+	cursor, err := webhookCollection.Find(ctx, bson.M{
+		"active": true,
+		"events": bson.M{"$in": []string{outboxEvent.Type, "*"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var webhooks []models.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	event := WebhookEvent{
+		ID:        outboxEvent.Event_id,
+		Type:      outboxEvent.Type,
+		CreatedAt: outboxEvent.Created_at,
+		Data:      outboxEvent.Payload,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	deliveries := make([]interface{}, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		delivery := models.WebhookDelivery{
+			ID:              primitive.NewObjectID(),
+			Webhook_id:      webhook.Webhook_id,
+			Event_id:        event.ID,
+			Event_type:      event.Type,
+			Payload:         string(payload),
+			Status:          DeliveryPending,
+			Next_attempt_at: now,
+			Created_at:      now,
+		}
+		delivery.Delivery_id = delivery.ID.Hex()
+		deliveries = append(deliveries, delivery)
+	}
+
+	_, err = webhookDeliveryCollection.InsertMany(ctx, deliveries, options.InsertMany().SetOrdered(false))
+	if onlyDuplicateKeyErrors(err) {
+		return nil
+	}
+	return err
+}
+
+// onlyDuplicateKeyErrors reports whether every write of a bulk insert either succeeded
+// or found its document already there
+func onlyDuplicateKeyErrors(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// SignWebhookPayload returns the signature header value "t=<unix time>,v1=<hex HMAC-SHA256>"
+// where the HMAC is computed over "<unix time>.<body>" with the webhook secret
+func SignWebhookPayload(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartWebhookWorker delivers queued webhook events in the background until ctx is done
+func StartWebhookWorker(ctx context.Context) {
+	// Ensure initialization
+	if webhookDeliveryCollection == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Drain everything that is due before sleeping again
+			for deliverNextWebhook(ctx) {
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// deliverNextWebhook claims one due delivery and attempts it. It reports whether a delivery was found.
+func deliverNextWebhook(ctx context.Context) bool {
+	now := time.Now().UTC()
+
+	// Claim the delivery by pushing its next attempt past the lease, so other workers skip it
+	var delivery models.WebhookDelivery
+	err := webhookDeliveryCollection.FindOneAndUpdate(ctx,
+		bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"next_attempt_at": now.Add(webhookLease), "last_attempt_at": now},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("Failed to claim webhook delivery:", err)
+		}
+		return false
+	}
+
+	update := bson.M{}
+	var webhook models.Webhook
+	err = webhookCollection.FindOne(ctx, bson.M{"webhook_id": delivery.Webhook_id}).Decode(&webhook)
+	if err != nil || !webhook.Active {
+		// The endpoint was removed or disabled after the event was queued
+		update["status"] = DeliveryFailed
+		update["last_error"] = "webhook was deleted or deactivated"
+	} else {
+		status, deliveryErr := sendWebhook(ctx, webhook, delivery)
+		update["response_status"] = status
+
+		switch {
+		case deliveryErr == nil:
+			update["status"] = DeliverySucceeded
+			update["delivered_at"] = time.Now().UTC()
+			update["last_error"] = ""
+		case delivery.Attempts >= webhookMaxAttempts:
+			update["status"] = DeliveryFailed
+			update["last_error"] = deliveryErr.Error()
+		default:
+			update["next_attempt_at"] = time.Now().UTC().Add(webhookRetryDelay(delivery.Attempts))
+			update["last_error"] = deliveryErr.Error()
+		}
+	}
+
+	_, err = webhookDeliveryCollection.UpdateOne(ctx, bson.M{"delivery_id": delivery.Delivery_id}, bson.M{"$set": update})
+	if err != nil {
+		log.Println("Failed to record webhook delivery:", err)
+	}
+	return true
+}
+
+// sendWebhook posts a delivery to its endpoint and returns the response status
+func sendWebhook(ctx context.Context, webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "JWT-MongoDb-Go-Webhooks/1.0")
+	request.Header.Set(WebhookEventHeader, delivery.Event_type)
+	request.Header.Set(WebhookDeliveryHeader, delivery.Delivery_id)
+	request.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, time.Now(), body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return response.StatusCode, fmt.Errorf("endpoint responded %d: %s", response.StatusCode, snippet)
+	}
+	return response.StatusCode, nil
+}
+
+// webhookRetryDelay returns the wait before the next attempt after the given number of attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMax)
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/kaa-dan/JWT-MongoDb-Go/controllers"
 	"github.com/kaa-dan/JWT-MongoDb-Go/database"
 	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/middlewares"
 	"github.com/kaa-dan/JWT-MongoDb-Go/routes"
 )
 
@@ -24,8 +30,47 @@ func main() {
 
 	// Initialize package-level variables after DB connection
 	helpers.InitializeTokenHelper()
+	helpers.InitializeJWEHelper()
+	helpers.InitializeAuthHelper()
+	helpers.InitializeCookieHelper()
+	helpers.InitializeMailHelper()
+	helpers.InitializeDPoPHelper()
+	middlewares.InitializeTokenExtractors()
+	helpers.InitializeOIDCHelper()
+	helpers.InitializePATHelper()
+	helpers.InitializeWebAuthnHelper()
+	helpers.InitializeLoginRiskHelper()
+	helpers.InitializeAuditHelper()
+	helpers.InitializeWebhookHelper()
+	helpers.InitializeOutboxHelper()
+	helpers.InitializeUserLifecycleHelper()
+	helpers.InitializeUserListHelper()
+	helpers.InitializeDataExportHelper()
+	helpers.InitializeErasureHelper()
+	helpers.InitializeAccountStatusHelper()
 	controllers.InitializeAuthController()
 	controllers.InitializeUserController()
+	controllers.InitializeTokenController()
+	controllers.InitializeImpersonationController()
+	controllers.InitializeMagicLinkController()
+	controllers.InitializeAuditController()
+	controllers.InitializeWebhookController()
+
+	// The background workers run until the process is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Deliver queued webhook events in the background
+	helpers.StartWebhookWorker(ctx)
+
+	// Publish domain events from the outbox in the background
+	helpers.StartOutboxRelay(ctx)
+
+	// Purge deleted users once their retention period has passed
+	helpers.StartUserPurgeJob(ctx)
+
+	// Build requested data exports in the background
+	helpers.StartDataExportWorker(ctx)
 
 	// Set Gin mode based on environment
 	if os.Getenv("GIN_MODE") == "release" {
@@ -43,11 +88,26 @@ func main() {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
+	// Browsers only send cookies cross-origin to explicitly allowed origins
+	allowedOrigins := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins[origin] = true
+		}
+	}
+
 	// Add CORS middleware for production
 	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		if origin := c.GetHeader("Origin"); allowedOrigins[origin] {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Vary", "Origin")
+		} else if len(allowedOrigins) == 0 {
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, token")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, token, DPoP")
+		c.Header("Access-Control-Expose-Headers", "WWW-Authenticate")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -60,6 +120,8 @@ func main() {
 	// Setup routes
 	routes.AuthRoutes(router)
 	routes.UserRoutes(router)
+	routes.AuditRoutes(router)
+	routes.WebhookRoutes(router)
 
 	// Health check endpoint
 	router.GET("/health", func(ctx *gin.Context) {
@@ -69,6 +131,28 @@ func main() {
 		})
 	})
 
-	log.Printf("Starting server on port %s", port)
-	router.Run(":" + port)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	go func() {
+		log.Printf("Starting server on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Server failed: ", err)
+		}
+	}()
+
+	// Stop accepting requests on a signal and give in-flight ones time to finish
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Server did not shut down cleanly:", err)
+	}
+
+	database.DisconnectDB()
 }
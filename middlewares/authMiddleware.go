@@ -1,7 +1,6 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,24 +10,65 @@ import (
 // Authenticate validates JWT token and sets user context
 func Authenticate() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// Get token from Authorization header
-		clientToken := c.Request.Header.Get("token")
+		// Get token from the configured extractors
+		clientToken, tokenSource, extractErr := extractToken(c)
+		if extractErr != nil {
+			helpers.AbortWithChallenge(c, http.StatusBadRequest, helpers.ChallengeScheme(c), helpers.ErrInvalidRequest, extractErr.Error())
+			return
+		}
 
 		if clientToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "No Authorization header provided",
-			})
-			c.Abort()
+			// RFC 6750 section 3.1: no error code when no credentials were sent
+			helpers.AbortWithChallenge(c, http.StatusUnauthorized, helpers.ChallengeScheme(c), "", "No access token provided")
 			return
 		}
 
-		// Validate the token
-		claims, err := helpers.ValidateToken(clientToken)
+		// Validate the token, either a personal access token or a JWT
+		var claims *helpers.SignedDetails
+		var err string
+		authMethod := "jwt"
+		if helpers.IsPersonalAccessToken(clientToken) {
+			authMethod = "pat"
+			claims, err = helpers.ValidatePersonalAccessToken(clientToken)
+		} else {
+			claims, err = helpers.ValidateToken(clientToken)
+		}
 		if err != "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": fmt.Sprintf("Invalid token: %s", err),
-			})
-			c.Abort()
+			helpers.AbortWithChallenge(c, http.StatusUnauthorized, helpers.ChallengeScheme(c), helpers.ErrInvalidToken, invalidTokenDescription(err))
+			return
+		}
+
+		// Refresh tokens live longer and are only for getting new access tokens
+		if claims.Typ == helpers.TokenTypeRefresh {
+			helpers.AbortWithChallenge(c, http.StatusUnauthorized, helpers.ChallengeScheme(c), helpers.ErrInvalidToken, "A refresh token cannot be used as an access token")
+			return
+		}
+
+		// DPoP-bound tokens are only accepted with a fresh proof from the bound key
+		if claims.Cnf != nil {
+			jkt, proofErr := helpers.ValidateDPoPProof(c.GetHeader("DPoP"), c.Request.Method, helpers.RequestURL(c.Request), clientToken)
+			if proofErr == nil && jkt != claims.Cnf.Jkt {
+				proofErr = errDPoPKeyMismatch
+			}
+			if proofErr != nil {
+				helpers.AbortWithChallenge(c, http.StatusUnauthorized, "DPoP", helpers.ErrInvalidDPoPProof, proofErr.Error())
+				return
+			}
+			c.Set("dpop_jkt", jkt)
+		}
+
+		// Tokens of deleted and suspended users stop working even before they expire
+		state, stateErr := helpers.GetUserState(c.Request.Context(), claims.Uid)
+		if stateErr != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error occurred while checking the account"})
+			return
+		}
+		if !state.Exists {
+			helpers.AbortWithChallenge(c, http.StatusUnauthorized, helpers.ChallengeScheme(c), helpers.ErrInvalidToken, invalidTokenDescription(helpers.MsgTokenRevoked))
+			return
+		}
+		if status := state.AccountStatus(); status != helpers.StatusActive {
+			helpers.AbortWithChallenge(c, http.StatusUnauthorized, helpers.ChallengeScheme(c), helpers.ErrInvalidToken, helpers.AccountStatusMessage(status))
 			return
 		}
 
@@ -38,8 +78,39 @@ func Authenticate() gin.HandlerFunc {
 		c.Set("last_name", claims.Last_name)
 		c.Set("uid", claims.Uid)
 		c.Set("user_type", claims.User_type)
+		c.Set("auth_method", authMethod)
+		c.Set("token_source", tokenSource)
+		c.Set("scopes", claims.Scopes())
+		if claims.ExpiresAt != nil {
+			c.Set("expires_at", claims.ExpiresAt.Time)
+		}
+		if claims.Auth_time != nil {
+			c.Set("auth_time", claims.Auth_time.Time)
+		}
+
+		// Expose the real caller when an admin is acting as this user
+		c.Set("impersonated", claims.Act != nil)
+		if claims.Act != nil {
+			c.Set("actor_uid", claims.Act.Sub)
+			c.Set("actor_email", claims.Act.Email)
+			c.Set("impersonation_session_id", claims.ID)
+		}
 
 		// Continue to next handler
 		c.Next()
 	})
 }
+
+// invalidTokenDescription turns a validation message into an error_description
+func invalidTokenDescription(msg string) string {
+	switch msg {
+	case helpers.MsgTokenExpired:
+		return "The access token expired"
+	case helpers.MsgTokenMalformed:
+		return "The access token is malformed"
+	case helpers.MsgTokenRevoked:
+		return "The access token has been revoked"
+	default:
+		return "The access token is invalid"
+	}
+}
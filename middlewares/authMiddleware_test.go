@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+func TestAuthenticateRejectsRefreshTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	helpers.SECRET_KEY = "test-secret"
+	TokenExtractors = []TokenExtractor{BearerExtractor}
+
+	token, refreshToken, err := helpers.GenerateAllTokens("user@example.com", "Test", "User", "USER", "user-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+
+	claims, msg := helpers.ValidateToken(token)
+	if msg != "" || claims.Typ != helpers.TokenTypeAccess {
+		t.Fatalf("access token typ = %q (%s), want %q", claims.Typ, msg, helpers.TokenTypeAccess)
+	}
+	claims, msg = helpers.ValidateToken(refreshToken)
+	if msg != "" || claims.Typ != helpers.TokenTypeRefresh {
+		t.Fatalf("refresh token typ = %q (%s), want %q", claims.Typ, msg, helpers.TokenTypeRefresh)
+	}
+
+	router := gin.New()
+	router.GET("/", Authenticate(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="invalid_token"`) {
+		t.Fatalf("challenge = %q, want an invalid_token error", challenge)
+	}
+}
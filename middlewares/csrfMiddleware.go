@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// CSRFProtect requires a matching X-CSRF-Token header and csrf_token cookie on
+// state-changing requests authenticated by cookie. It must run after Authenticate.
+func CSRFProtect() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		// Header-based credentials are not sent automatically by browsers
+		if c.GetString("token_source") == "cookie" && !helpers.CheckCSRFToken(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Missing or invalid CSRF token",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
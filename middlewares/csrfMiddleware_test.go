@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		method string
+		source string
+		cookie string
+		header string
+		want   int
+	}{
+		{name: "matching token", method: http.MethodPost, source: "cookie", cookie: "csrf-1", header: "csrf-1", want: http.StatusOK},
+		{name: "no header", method: http.MethodPost, source: "cookie", cookie: "csrf-1", want: http.StatusForbidden},
+		{name: "no cookie", method: http.MethodDelete, source: "cookie", header: "csrf-1", want: http.StatusForbidden},
+		{name: "other token", method: http.MethodPut, source: "cookie", cookie: "csrf-1", header: "csrf-2", want: http.StatusForbidden},
+		{name: "empty tokens", method: http.MethodPost, source: "cookie", cookie: "", header: "", want: http.StatusForbidden},
+		{name: "safe method", method: http.MethodGet, source: "cookie", want: http.StatusOK},
+		{name: "bearer token", method: http.MethodPost, source: "header", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Handle(test.method, "/", func(c *gin.Context) {
+				c.Set("token_source", test.source)
+			}, CSRFProtect(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, "/", nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: helpers.CSRFCookie, Value: test.cookie})
+			}
+			if test.header != "" {
+				req.Header.Set(helpers.CSRFHeader, test.header)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != test.want {
+				t.Fatalf("status = %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// DenyImpersonation blocks sensitive routes for tokens issued through admin impersonation.
+// It must run after Authenticate.
+func DenyImpersonation() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if err := helpers.CheckNotImpersonated(c); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// RequireScopes rejects requests whose token was not granted every listed scope.
+// It must run after Authenticate.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	required := strings.Join(scopes, " ")
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if !helpers.HasScopes(c.GetStringSlice("scopes"), scopes...) {
+			description := "The request requires higher privileges than provided by the access token"
+
+			// RFC 6750 section 3.1
+			helpers.AbortWithChallenge(c, http.StatusForbidden, helpers.ChallengeScheme(c), helpers.ErrInsufficientScope, description, "scope", required)
+			return
+		}
+
+		c.Next()
+	})
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// RequireRecentAuth rejects requests whose user authenticated longer than maxAge ago.
+// It must run after Authenticate.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if err := helpers.CheckRecentAuth(c, maxAge); err != nil {
+			helpers.AbortInsufficientAuthentication(c, maxAge, err.Error())
+			return
+		}
+
+		c.Next()
+	})
+}
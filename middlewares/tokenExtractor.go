@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+// TokenExtractor reads a credential from one place in the request. It returns an
+// empty token when nothing is there, and an error when something is there but unusable.
+type TokenExtractor struct {
+	Name    string
+	Extract func(c *gin.Context) (token string, err error)
+}
+
+var errMalformedAuthorization = errors.New("the Authorization header is malformed")
+var errDPoPKeyMismatch = errors.New("DPoP proof key does not match the token binding")
+
+// BearerExtractor reads "Authorization: Bearer <token>" (RFC 6750 section 2.1)
+var BearerExtractor = TokenExtractor{Name: "bearer", Extract: authorizationScheme("Bearer")}
+
+// DPoPExtractor reads "Authorization: DPoP <token>" (RFC 9449 section 7.1)
+var DPoPExtractor = TokenExtractor{Name: "dpop", Extract: authorizationScheme("DPoP")}
+
+// HeaderExtractor reads the legacy "token" header
+var HeaderExtractor = TokenExtractor{Name: "header", Extract: func(c *gin.Context) (string, error) {
+	return c.GetHeader("token"), nil
+}}
+
+// CookieExtractor reads the access token cookie set in browser session mode
+var CookieExtractor = TokenExtractor{Name: "cookie", Extract: func(c *gin.Context) (string, error) {
+	token, _ := c.Cookie(helpers.AccessTokenCookie)
+	return token, nil
+}}
+
+// QueryExtractor reads the access_token query parameter, only on websocket upgrade
+// requests where browsers cannot set headers (RFC 6750 section 2.3)
+var QueryExtractor = TokenExtractor{Name: "query", Extract: func(c *gin.Context) (string, error) {
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		return "", nil
+	}
+	return c.Query("access_token"), nil
+}}
+
+// TokenExtractors are tried in order by Authenticate
+var TokenExtractors = []TokenExtractor{BearerExtractor, DPoPExtractor, HeaderExtractor, CookieExtractor, QueryExtractor}
+
+// InitializeTokenExtractors selects and orders the extractors from AUTH_TOKEN_EXTRACTORS,
+// a comma separated list of bearer, dpop, header, cookie and query. By default all
+// are enabled, except cookie outside browser session mode.
+func InitializeTokenExtractors() {
+	available := map[string]TokenExtractor{}
+	for _, extractor := range []TokenExtractor{BearerExtractor, DPoPExtractor, HeaderExtractor, CookieExtractor, QueryExtractor} {
+		available[extractor.Name] = extractor
+	}
+
+	raw := os.Getenv("AUTH_TOKEN_EXTRACTORS")
+	if raw == "" {
+		raw = "bearer,dpop,header,query"
+		if helpers.CookieSessions {
+			raw = "bearer,dpop,header,cookie,query"
+		}
+	}
+
+	TokenExtractors = nil
+	for _, name := range strings.Split(raw, ",") {
+		extractor, ok := available[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			log.Fatalf("Unknown token extractor %q in AUTH_TOKEN_EXTRACTORS", name)
+		}
+		TokenExtractors = append(TokenExtractors, extractor)
+	}
+}
+
+// extractToken returns the first token found by the configured extractors and the name of the extractor
+func extractToken(c *gin.Context) (token string, source string, err error) {
+	for _, extractor := range TokenExtractors {
+		token, err = extractor.Extract(c)
+		if err != nil || token != "" {
+			return token, extractor.Name, err
+		}
+	}
+	return "", "", nil
+}
+
+// authorizationScheme extracts the credentials of an Authorization header using scheme
+func authorizationScheme(scheme string) func(c *gin.Context) (string, error) {
+	return func(c *gin.Context) (string, error) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			return "", nil
+		}
+
+		name, value, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(name, scheme) {
+			return "", nil
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" || strings.Contains(value, " ") {
+			return "", errMalformedAuthorization
+		}
+		return value, nil
+	}
+}
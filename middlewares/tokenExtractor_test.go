@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+)
+
+func TestExtractToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	all := []TokenExtractor{BearerExtractor, DPoPExtractor, HeaderExtractor, CookieExtractor, QueryExtractor}
+
+	tests := []struct {
+		name       string
+		extractors []TokenExtractor
+		target     string
+		headers    map[string]string
+		cookie     string
+		wantToken  string
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "nothing", extractors: all, target: "/"},
+		{name: "bearer", extractors: all, target: "/", headers: map[string]string{"Authorization": "Bearer abc"}, wantToken: "abc", wantSource: "bearer"},
+		{name: "scheme in any case", extractors: all, target: "/", headers: map[string]string{"Authorization": "bearer abc"}, wantToken: "abc", wantSource: "bearer"},
+		{name: "dpop", extractors: all, target: "/", headers: map[string]string{"Authorization": "DPoP abc"}, wantToken: "abc", wantSource: "dpop"},
+		{name: "empty credentials", extractors: all, target: "/", headers: map[string]string{"Authorization": "Bearer "}, wantSource: "bearer", wantErr: true},
+		{name: "credentials with spaces", extractors: all, target: "/", headers: map[string]string{"Authorization": "Bearer abc def"}, wantSource: "bearer", wantErr: true},
+		{name: "other scheme falls through", extractors: all, target: "/", headers: map[string]string{"Authorization": "Basic abc", "token": "legacy"}, wantToken: "legacy", wantSource: "header"},
+		{name: "legacy header", extractors: all, target: "/", headers: map[string]string{"token": "legacy"}, wantToken: "legacy", wantSource: "header"},
+		{name: "first extractor wins", extractors: all, target: "/", headers: map[string]string{"Authorization": "Bearer abc", "token": "legacy"}, wantToken: "abc", wantSource: "bearer"},
+		{name: "cookie", extractors: all, target: "/", cookie: "from-cookie", wantToken: "from-cookie", wantSource: "cookie"},
+		{name: "cookie extractor disabled", extractors: []TokenExtractor{BearerExtractor, HeaderExtractor}, target: "/", cookie: "from-cookie"},
+		{name: "query on websocket upgrade", extractors: all, target: "/ws?access_token=abc", headers: map[string]string{"Upgrade": "websocket"}, wantToken: "abc", wantSource: "query"},
+		{name: "query without upgrade", extractors: all, target: "/ws?access_token=abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			TokenExtractors = test.extractors
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, test.target, nil)
+			for name, value := range test.headers {
+				c.Request.Header.Set(name, value)
+			}
+			if test.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: helpers.AccessTokenCookie, Value: test.cookie})
+			}
+
+			token, source, err := extractToken(c)
+			if token != test.wantToken || source != test.wantSource || (err != nil) != test.wantErr {
+				t.Fatalf("extractToken = %q, %q, %v; want %q, %q, error %v", token, source, err, test.wantToken, test.wantSource, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitializeTokenExtractors(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            string
+		cookieSessions bool
+		want           []string
+	}{
+		{name: "default", want: []string{"bearer", "dpop", "header", "query"}},
+		{name: "default with cookie sessions", cookieSessions: true, want: []string{"bearer", "dpop", "header", "cookie", "query"}},
+		{name: "configured order", env: " Cookie, bearer ", want: []string{"cookie", "bearer"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("AUTH_TOKEN_EXTRACTORS", test.env)
+			helpers.CookieSessions = test.cookieSessions
+			t.Cleanup(func() { helpers.CookieSessions = false })
+
+			InitializeTokenExtractors()
+
+			var names []string
+			for _, extractor := range TokenExtractors {
+				names = append(names, extractor.Name)
+			}
+			if len(names) != len(test.want) {
+				t.Fatalf("extractors = %v, want %v", names, test.want)
+			}
+			for i := range names {
+				if names[i] != test.want[i] {
+					t.Fatalf("extractors = %v, want %v", names, test.want)
+				}
+			}
+		})
+	}
+}
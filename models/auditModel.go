@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEvent is one entry of the append-only, hash-chained security audit log.
+// Hash covers the previous entry's hash and every field below except the personal
+// data, which is covered through Pii_digest instead. Redacted entries had their
+// personal data erased and are checked against the stored digest alone. Hash_version
+// tells how the fields were encoded for hashing.
+type AuditEvent struct {
+	ID              primitive.ObjectID `bson:"_id" json:"-"`
+	Event_id        string             `json:"event_id"`
+	Sequence        int64              `json:"sequence"`
+	Action          string             `json:"action"`
+	Outcome         string             `json:"outcome"`
+	Actor_id        string             `json:"actor_id,omitempty"`
+	Actor_email     string             `json:"actor_email,omitempty"`
+	Impersonator_id string             `json:"impersonator_id,omitempty"`
+	Target_type     string             `json:"target_type,omitempty"`
+	Target_id       string             `json:"target_id,omitempty"`
+	Reason          string             `json:"reason,omitempty"`
+	Changes         map[string]string  `json:"changes,omitempty"`
+	Ip_address      string             `json:"ip_address,omitempty"`
+	User_agent      string             `json:"user_agent,omitempty"`
+	Pii_digest      string             `json:"pii_digest"`
+	Redacted        bool               `json:"redacted,omitempty" bson:"redacted,omitempty"`
+	Created_at      time.Time          `json:"created_at"`
+	Prev_hash       string             `json:"prev_hash"`
+	Hash            string             `json:"hash"`
+	Hash_version    int                `json:"hash_version,omitempty" bson:"hash_version,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataExport is a request for a copy of everything stored about a user. The bundle is
+// built in the background and kept in GridFS until the export expires.
+type DataExport struct {
+	ID            primitive.ObjectID  `bson:"_id" json:"-"`
+	Export_id     string              `json:"export_id"`
+	User_id       string              `json:"user_id"`
+	Requested_by  string              `json:"requested_by"`
+	Format        string              `json:"format"`
+	Status        string              `json:"status"`
+	Attempts      int                 `json:"-"`
+	Claimed_until *time.Time          `json:"-"`
+	File_id       *primitive.ObjectID `json:"-"`
+	Size          int64               `json:"size,omitempty"`
+	Last_error    string              `json:"last_error,omitempty"`
+	Created_at    time.Time           `json:"created_at"`
+	Completed_at  *time.Time          `json:"completed_at"`
+	Expires_at    time.Time           `json:"expires_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErasureCertificate records that a user's personal data was irreversibly erased, by whom,
+// and how many records were scrubbed in each collection. It holds no personal data itself.
+type ErasureCertificate struct {
+	ID             primitive.ObjectID `bson:"_id" json:"-"`
+	Certificate_id string             `json:"certificate_id"`
+	User_id        string             `json:"user_id"`
+	Erased_by      string             `json:"erased_by"`
+	Reason         string             `json:"reason"`
+	Records        map[string]int64   `json:"records"`
+	Erased_at      time.Time          `json:"erased_at"`
+	Hash           string             `json:"hash"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImpersonationSession records an admin acting as another user
+type ImpersonationSession struct {
+	ID          primitive.ObjectID `bson:"_id" json:"-"`
+	Session_id  string             `json:"session_id"`
+	Admin_id    string             `json:"admin_id"`
+	Admin_email string             `json:"admin_email"`
+	Target_id   string             `json:"target_id"`
+	Reason      string             `json:"reason"`
+	Ip_address  string             `json:"ip_address"`
+	User_agent  string             `json:"user_agent"`
+	Created_at  time.Time          `json:"created_at"`
+	Expires_at  time.Time          `json:"expires_at"`
+}
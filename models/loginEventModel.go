@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginEvent records where a successful login came from and how unusual it looked
+type LoginEvent struct {
+	ID                primitive.ObjectID `bson:"_id" json:"-"`
+	Event_id          string             `json:"event_id"`
+	User_id           string             `json:"user_id"`
+	Method            string             `json:"method"`
+	Ip_address        string             `json:"ip_address"`
+	User_agent        string             `json:"user_agent"`
+	Device            string             `json:"device"`
+	Country           string             `json:"country,omitempty"`
+	City              string             `json:"city,omitempty"`
+	Latitude          *float64           `json:"latitude,omitempty"`
+	Longitude         *float64           `json:"longitude,omitempty"`
+	New_device        bool               `json:"new_device"`
+	New_country       bool               `json:"new_country"`
+	Impossible_travel bool               `json:"impossible_travel"`
+	Risky             bool               `json:"risky"`
+	Created_at        time.Time          `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MagicLink is a single-use passwordless login link. A record is written for every
+// request, including unknown addresses, so rate limiting does not reveal accounts.
+type MagicLink struct {
+	ID         primitive.ObjectID `bson:"_id" json:"-"`
+	Link_id    string             `json:"link_id"`
+	User_id    string             `json:"user_id"`
+	Email      string             `json:"email"`
+	Nonce_hash string             `json:"-"`
+	Ip_address string             `json:"ip_address"`
+	Created_at time.Time          `json:"created_at"`
+	Expires_at time.Time          `json:"expires_at"`
+	Used_at    *time.Time         `json:"used_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change it
+// describes and published to the message broker afterwards by the outbox relay
+type OutboxEvent struct {
+	ID            primitive.ObjectID     `bson:"_id" json:"-"`
+	Event_id      string                 `json:"event_id"`
+	Type          string                 `json:"type"`
+	Aggregate_id  string                 `json:"aggregate_id"`
+	Payload       map[string]interface{} `json:"payload"`
+	Created_at    time.Time              `json:"created_at"`
+	Attempts      int                    `json:"attempts"`
+	Claimed_until *time.Time             `json:"claimed_until"`
+	Last_error    string                 `json:"last_error,omitempty"`
+	Published_at  *time.Time             `json:"published_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PersonalAccessToken is a long-lived, user-created API credential. Only the
+// SHA-256 hash of the secret is stored; the plain value is shown once on creation.
+type PersonalAccessToken struct {
+	ID           primitive.ObjectID `bson:"_id" json:"-"`
+	Token_id     string             `json:"token_id"`
+	User_id      string             `json:"user_id"`
+	Name         string             `json:"name"`
+	Scopes       []string           `json:"scopes"`
+	Token_hash   string             `json:"-"`
+	Token_prefix string             `json:"token_prefix"`
+	Created_at   time.Time          `json:"created_at"`
+	Expires_at   *time.Time         `json:"expires_at"`
+	Last_used_at *time.Time         `json:"last_used_at"`
+	Revoked_at   *time.Time         `json:"revoked_at"`
+}
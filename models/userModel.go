@@ -7,16 +7,66 @@ import (
 )
 
 type User struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
-	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Password      *string            `json:"Password" validate:"required,min=6"`
-	Email         *string            `json:"email" validate:"email,required"`
-	Phone         *string            `json:"phone" validate:"required"`
-	Token         *string            `json:"token"`
-	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Refresh_token *string            `json:"refresh_token"`
-	Created_at    time.Time          `json:"created_at"`
-	Updated_at    time.Time          `json:"updated_at"`
-	User_id       string             `json:"user_id"`
+	ID            primitive.ObjectID  `bson:"_id"`
+	First_name    *string             `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name     *string             `json:"last_name" validate:"required,min=2,max=100"`
+	Password      *string             `json:"Password" validate:"required,min=6"`
+	Email         *string             `json:"email" validate:"email,required"`
+	Phone         *string             `json:"phone"`
+	Token         *string             `json:"token"`
+	User_type     *string             `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
+	Refresh_token *string             `json:"refresh_token"`
+	Created_at    time.Time           `json:"created_at"`
+	Updated_at    time.Time           `json:"updated_at"`
+	User_id       string              `json:"user_id"`
+	Identities    []FederatedIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+	Deleted_at    *time.Time          `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Deleted_by    *string             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	Erased_at     *time.Time          `json:"erased_at,omitempty" bson:"erased_at,omitempty"`
+
+	// Account status; absent means active
+	Status            *string    `json:"status,omitempty" bson:"status,omitempty"`
+	Status_reason     *string    `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
+	Status_until      *time.Time `json:"status_until,omitempty" bson:"status_until,omitempty"`
+	Status_changed_at *time.Time `json:"status_changed_at,omitempty" bson:"status_changed_at,omitempty"`
+	Status_changed_by *string    `json:"status_changed_by,omitempty" bson:"status_changed_by,omitempty"`
+
+	// Imported accounts without a password must set one before signing in with a password
+	Password_reset_required bool `json:"password_reset_required,omitempty" bson:"password_reset_required,omitempty"`
+}
+
+// FederatedIdentity links a user to an account at an upstream OIDC provider
+type FederatedIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	Linked_at time.Time `json:"linked_at"`
+}
+
+// UserProfile is the view of a user returned to the user themselves. It never carries
+// the password hash or tokens.
+type UserProfile struct {
+	User_id                 string              `json:"user_id"`
+	First_name              string              `json:"first_name"`
+	Last_name               string              `json:"last_name"`
+	Email                   string              `json:"email"`
+	Phone                   string              `json:"phone"`
+	User_type               string              `json:"user_type"`
+	Status                  string              `json:"status"`
+	Identities              []FederatedIdentity `json:"identities,omitempty"`
+	Password_reset_required bool                `json:"password_reset_required,omitempty"`
+	Created_at              time.Time           `json:"created_at"`
+	Updated_at              time.Time           `json:"updated_at"`
+}
+
+// UserRecord is the admin view of a user: the profile plus how the account is managed
+type UserRecord struct {
+	UserProfile
+	Status_reason     *string    `json:"status_reason,omitempty"`
+	Status_until      *time.Time `json:"status_until,omitempty"`
+	Status_changed_at *time.Time `json:"status_changed_at,omitempty"`
+	Status_changed_by *string    `json:"status_changed_by,omitempty"`
+	Deleted_at        *time.Time `json:"deleted_at,omitempty"`
+	Deleted_by        *string    `json:"deleted_by,omitempty"`
+	Erased_at         *time.Time `json:"erased_at,omitempty"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID               primitive.ObjectID `bson:"_id" json:"-"`
+	Credential_id    string             `json:"credential_id"`
+	User_id          string             `json:"user_id"`
+	Name             string             `json:"name"`
+	Public_key       []byte             `json:"-"`
+	Attestation_type string             `json:"attestation_type"`
+	Transports       []string           `json:"transports"`
+	Aaguid           []byte             `json:"-"`
+	Sign_count       uint32             `json:"sign_count"`
+	Backup_eligible  bool               `json:"backup_eligible"`
+	Backup_state     bool               `json:"backup_state"`
+	Created_at       time.Time          `json:"created_at"`
+	Last_used_at     *time.Time         `json:"last_used_at"`
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony in progress
+type WebAuthnSession struct {
+	ID         primitive.ObjectID `bson:"_id" json:"-"`
+	Session_id string             `json:"session_id"`
+	User_id    string             `json:"user_id"`
+	Purpose    string             `json:"purpose"`
+	Method     string             `json:"method,omitempty"`
+	Data       []byte             `json:"-"`
+	Scope      string             `json:"scope"`
+	Expires_at time.Time          `json:"expires_at"`
+}
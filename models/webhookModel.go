@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is an endpoint registered by an admin to receive user lifecycle events
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"_id" json:"-"`
+	Webhook_id  string             `json:"webhook_id"`
+	Url         string             `json:"url"`
+	Events      []string           `json:"events"`
+	Description string             `json:"description"`
+	Secret      string             `json:"-"`
+	Active      bool               `json:"active"`
+	Created_by  string             `json:"created_by"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
+
+// WebhookDelivery is one event queued for one webhook, with the result of its latest attempt
+type WebhookDelivery struct {
+	ID              primitive.ObjectID `bson:"_id" json:"-"`
+	Delivery_id     string             `json:"delivery_id"`
+	Webhook_id      string             `json:"webhook_id"`
+	Event_id        string             `json:"event_id"`
+	Event_type      string             `json:"event_type"`
+	Payload         string             `json:"payload"`
+	Status          string             `json:"status"`
+	Attempts        int                `json:"attempts"`
+	Next_attempt_at time.Time          `json:"next_attempt_at"`
+	Last_attempt_at *time.Time         `json:"last_attempt_at"`
+	Response_status int                `json:"response_status,omitempty"`
+	Last_error      string             `json:"last_error,omitempty"`
+	Created_at      time.Time          `json:"created_at"`
+	Delivered_at    *time.Time         `json:"delivered_at"`
+}
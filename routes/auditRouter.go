@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/controllers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/middlewares"
+)
+
+func AuditRoutes(r *gin.Engine) {
+	auditGroup := r.Group("/audit")
+	auditGroup.Use(middlewares.Authenticate(), middlewares.CSRFProtect(), middlewares.RequireScopes(helpers.ScopeAuditRead))
+	{
+		auditGroup.GET("", controllers.GetAuditEvents())        // GET /audit - Search the audit log (Admin only)
+		auditGroup.GET("/verify", controllers.VerifyAuditLog()) // GET /audit/verify - Check the audit log hash chain (Admin only)
+	}
+}
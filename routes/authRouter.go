@@ -3,6 +3,8 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/kaa-dan/JWT-MongoDb-Go/controllers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/middlewares"
 )
 
 func AuthRoutes(r *gin.Engine) {
@@ -10,5 +12,21 @@ func AuthRoutes(r *gin.Engine) {
 	{
 		authGroup.POST("/signup", controllers.Signup()) //POST /auth/signup  - create new user
 		authGroup.POST("/login", controllers.Login())   // POST /auth/login  - login already existing user
+
+		authGroup.POST("/refresh", controllers.Refresh())                                                                      // POST /auth/refresh - exchange a refresh token for new tokens
+		authGroup.POST("/reauthenticate", middlewares.Authenticate(), middlewares.CSRFProtect(), controllers.Reauthenticate()) // POST /auth/reauthenticate - refresh auth_time of the current session
+		authGroup.POST("/logout", middlewares.Authenticate(), middlewares.CSRFProtect(), controllers.Logout())                 // POST /auth/logout - end the current session
+
+		authGroup.POST("/magic-link", controllers.RequestMagicLink())          // POST /auth/magic-link - email a single-use login link
+		authGroup.GET("/magic-link/callback", controllers.MagicLinkCallback()) // GET /auth/magic-link/callback - log in with an emailed link
+
+		authGroup.POST("/webauthn/login/begin", controllers.BeginPasskeyLogin())   // POST /auth/webauthn/login/begin - start a passkey login
+		authGroup.POST("/webauthn/login/finish", controllers.FinishPasskeyLogin()) // POST /auth/webauthn/login/finish - finish a passkey login or second factor
+
+		authGroup.GET("/oidc/providers", controllers.OIDCProviders())         // GET /auth/oidc/providers - list configured identity providers
+		authGroup.GET("/oidc/:provider/login", controllers.OIDCLogin())       // GET /auth/oidc/:provider/login - redirect to identity provider
+		authGroup.GET("/oidc/:provider/callback", controllers.OIDCCallback()) // GET /auth/oidc/:provider/callback - finish federated login or linking
+
+		authGroup.POST("/oidc/:provider/link", middlewares.Authenticate(), middlewares.CSRFProtect(), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.OIDCLink()) // POST /auth/oidc/:provider/link - link an identity provider to the signed in account
 	}
 }
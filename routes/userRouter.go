@@ -3,17 +3,44 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/kaa-dan/JWT-MongoDb-Go/controllers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
 	"github.com/kaa-dan/JWT-MongoDb-Go/middlewares"
 )
 
 func UserRoutes(r *gin.Engine) {
 	// Create a route group with authentication middleware
 	userGroup := r.Group("/users")
-	userGroup.Use(middlewares.Authenticate())
+	userGroup.Use(middlewares.Authenticate(), middlewares.CSRFProtect())
 	{
-		userGroup.GET("/", controllers.GetUsers())              // GET /users - Get all users (Admin only)
-		userGroup.GET("/:user_id", controllers.GetUser())       // GET /users/:user_id - Get user by ID
-		userGroup.PUT("/:user_id", controllers.UpdateUser())    // PUT /users/:user_id - Update user
-		userGroup.DELETE("/:user_id", controllers.DeleteUser()) // DELETE /users/:user_id - Delete user (Admin only)
+		userGroup.GET("/", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetUsers())                                                                                                      // GET /users - Get all users (Admin only)
+		userGroup.GET("/export", middlewares.RequireScopes(helpers.ScopeUsersRead), middlewares.DenyImpersonation(), controllers.ExportUsers())                                                            // GET /users/export - Stream all users as CSV or NDJSON (Admin only)
+		userGroup.POST("/import", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), controllers.ImportUsers())                                                          // POST /users/import - Import users from CSV or NDJSON (Admin only)
+		userGroup.GET("/:user_id", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetUser())                                                                                               // GET /users/:user_id - Get user by ID
+		userGroup.PUT("/:user_id", middlewares.RequireScopes(helpers.ScopeUsersWrite), controllers.UpdateUser())                                                                                           // PUT /users/:user_id - Update user
+		userGroup.DELETE("/:user_id", middlewares.RequireScopes(helpers.ScopeUsersDelete), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.DeleteUser()) // DELETE /users/:user_id - Delete user (Admin only)
+
+		userGroup.POST("/:user_id/restore", middlewares.RequireScopes(helpers.ScopeUsersDelete), middlewares.DenyImpersonation(), controllers.RestoreUser())                                                  // POST /users/:user_id/restore - Restore a deleted user (Admin only)
+		userGroup.POST("/:user_id/suspend", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), controllers.SuspendUser())                                                   // POST /users/:user_id/suspend - Suspend or lock an account (Admin only)
+		userGroup.POST("/:user_id/reinstate", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), controllers.ReinstateUser())                                               // POST /users/:user_id/reinstate - Reactivate a suspended, locked or pending account (Admin only)
+		userGroup.POST("/:user_id/erase", middlewares.RequireScopes(helpers.ScopeUsersDelete), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.EraseUser()) // POST /users/:user_id/erase - Irreversibly anonymize a user (Admin only)
+		userGroup.GET("/:user_id/erasure", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetErasureCertificate())                                                                            // GET /users/:user_id/erasure - Certificate of erasure (Admin only)
+
+		userGroup.GET("/:user_id/export", middlewares.RequireScopes(helpers.ScopeUsersRead), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.ExportUserData()) // GET /users/:user_id/export - Export everything stored about a user
+		userGroup.GET("/:user_id/exports/:export_id", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetDataExport())                                                                            // GET /users/:user_id/exports/:export_id - Status of a background export
+		userGroup.GET("/:user_id/exports/:export_id/download", middlewares.RequireScopes(helpers.ScopeUsersRead), middlewares.DenyImpersonation(), controllers.DownloadDataExport())                             // GET /users/:user_id/exports/:export_id/download - Download a finished export
+
+		userGroup.GET("/:user_id/logins", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetLoginHistory()) // GET /users/:user_id/logins - List recent logins
+
+		userGroup.GET("/:user_id/tokens", middlewares.RequireScopes(helpers.ScopeTokensRead), controllers.GetTokens())                                                  // GET /users/:user_id/tokens - List personal access tokens
+		userGroup.POST("/:user_id/tokens", middlewares.RequireScopes(helpers.ScopeTokensWrite), middlewares.DenyImpersonation(), controllers.CreateToken())             // POST /users/:user_id/tokens - Create personal access token (own account only)
+		userGroup.DELETE("/:user_id/tokens/:token_id", middlewares.RequireScopes(helpers.ScopeTokensWrite), middlewares.DenyImpersonation(), controllers.RevokeToken()) // DELETE /users/:user_id/tokens/:token_id - Revoke personal access token
+
+		userGroup.POST("/:user_id/webauthn/register/begin", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.BeginPasskeyRegistration())    // POST /users/:user_id/webauthn/register/begin - Start passkey registration (own account only)
+		userGroup.POST("/:user_id/webauthn/register/finish", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), controllers.FinishPasskeyRegistration())                                                       // POST /users/:user_id/webauthn/register/finish - Store a new passkey
+		userGroup.GET("/:user_id/webauthn/credentials", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetPasskeys())                                                                                                            // GET /users/:user_id/webauthn/credentials - List passkeys
+		userGroup.DELETE("/:user_id/webauthn/credentials/:credential_id", middlewares.RequireScopes(helpers.ScopeUsersWrite), middlewares.DenyImpersonation(), middlewares.RequireRecentAuth(helpers.StepUpMaxAge), controllers.DeletePasskey()) // DELETE /users/:user_id/webauthn/credentials/:credential_id - Remove a passkey
+
+		userGroup.POST("/:user_id/impersonate", middlewares.RequireScopes(helpers.ScopeUsersImpersonate), middlewares.DenyImpersonation(), controllers.Impersonate()) // POST /users/:user_id/impersonate - Start impersonation session (Admin only)
+		userGroup.GET("/:user_id/impersonations", middlewares.RequireScopes(helpers.ScopeUsersRead), controllers.GetImpersonationSessions())                          // GET /users/:user_id/impersonations - List impersonation sessions (Admin only)
 	}
 }
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kaa-dan/JWT-MongoDb-Go/controllers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/helpers"
+	"github.com/kaa-dan/JWT-MongoDb-Go/middlewares"
+)
+
+func WebhookRoutes(r *gin.Engine) {
+	webhookGroup := r.Group("/webhooks")
+	webhookGroup.Use(middlewares.Authenticate(), middlewares.CSRFProtect(), middlewares.RequireScopes(helpers.ScopeWebhooksManage))
+	{
+		webhookGroup.POST("", controllers.CreateWebhook())                                                  // POST /webhooks - Register a webhook (Admin only)
+		webhookGroup.GET("", controllers.GetWebhooks())                                                     // GET /webhooks - List webhooks (Admin only)
+		webhookGroup.PUT("/:webhook_id", controllers.UpdateWebhook())                                       // PUT /webhooks/:webhook_id - Update a webhook (Admin only)
+		webhookGroup.DELETE("/:webhook_id", controllers.DeleteWebhook())                                    // DELETE /webhooks/:webhook_id - Delete a webhook (Admin only)
+		webhookGroup.GET("/:webhook_id/deliveries", controllers.GetWebhookDeliveries())                     // GET /webhooks/:webhook_id/deliveries - Delivery log (Admin only)
+		webhookGroup.POST("/:webhook_id/deliveries/:delivery_id/redeliver", controllers.RedeliverWebhook()) // POST /webhooks/:webhook_id/deliveries/:delivery_id/redeliver - Retry a delivery (Admin only)
+	}
+}